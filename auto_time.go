@@ -0,0 +1,46 @@
+package orm
+
+import (
+	"reflect"
+	"time"
+	"web/orm/model"
+)
+
+// now 拿到当前时间，可以通过 DBWithClock 替换
+func (c core) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock()
+}
+
+// autoTimeValue 自动维护的时间字段要写入的值
+func autoTimeValue(fd *model.Field, now time.Time) any {
+	if fd.Type == reflect.TypeOf(time.Time{}) {
+		return now
+	}
+	if fd.Milli {
+		return now.UnixMilli()
+	}
+	return now.Unix()
+}
+
+// setAutoTime 直接修改实体上的字段
+// 这样不管用的是哪一种 valuer，后面读到的都是新的值
+// onlyZero 为 true 的时候，用户自己设置过的值不会被覆盖
+func setAutoTime(entity any, fd *model.Field, now time.Time, onlyZero bool) {
+	val := reflect.ValueOf(entity).Elem().FieldByName(fd.GoName)
+	if onlyZero && !val.IsZero() {
+		return
+	}
+	switch v := autoTimeValue(fd, now).(type) {
+	case time.Time:
+		val.Set(reflect.ValueOf(v))
+	case int64:
+		if val.CanInt() {
+			val.SetInt(v)
+		} else {
+			val.SetUint(uint64(v))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package orm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+	"time"
+	"web/orm/internal/errs"
+	"web/orm/internal/valuer"
+	"web/orm/model"
+)
+
+func TestAutoTime(t *testing.T) {
+	now := time.UnixMilli(1700000000123)
+	db := &DB{
+		core: core{
+			r:       model.NewRegistry(),
+			dialect: DialectMySOL,
+			creator: valuer.NewUnsafeValue,
+			clock: func() time.Time {
+				return now
+			},
+		},
+	}
+	created := time.UnixMilli(1600000000000)
+	testCases := []struct {
+		name      string
+		q         QueryBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name: "insert",
+			q:    NewInserter[AutoTimeModel](db).Values(&AutoTimeModel{Id: 1}),
+			wantQuery: &Query{
+				SQL:  "INSERT INTO `auto_time_model`(`id`,`ctime`,`utime`) VALUES (?,?,?);",
+				Args: []any{int64(1), now, now.UnixMilli()},
+			},
+		},
+		{
+			// 用户自己设置的创建时间不会被覆盖
+			name: "insert with create time",
+			q:    NewInserter[AutoTimeModel](db).Values(&AutoTimeModel{Id: 1, Ctime: created}),
+			wantQuery: &Query{
+				SQL:  "INSERT INTO `auto_time_model`(`id`,`ctime`,`utime`) VALUES (?,?,?);",
+				Args: []any{int64(1), created, now.UnixMilli()},
+			},
+		},
+		{
+			name: "upsert",
+			q: NewInserter[AutoTimeModel](db).Values(&AutoTimeModel{Id: 1}).
+				OnDuplicateKey().Update(C("Id")),
+			wantQuery: &Query{
+				SQL:  "INSERT INTO `auto_time_model`(`id`,`ctime`,`utime`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `id`=VALUES(`id`),`utime`=?;",
+				Args: []any{int64(1), now, now.UnixMilli(), now.UnixMilli()},
+			},
+		},
+		{
+			name: "update",
+			q: NewUpdater[AutoTimeModel](db).Update(&AutoTimeModel{Id: 1, Ctime: created}).
+				Where(C("Id").Eq(1)),
+			wantQuery: &Query{
+				SQL:  "UPDATE `auto_time_model` SET `id`=?,`ctime`=?,`utime`=? WHERE `id` = ?;",
+				Args: []any{int64(1), created, now.UnixMilli(), 1},
+			},
+		},
+		{
+			name: "update set",
+			q:    NewUpdater[AutoTimeModel](db).Set(Assign("Ctime", created)).Where(C("Id").Eq(1)),
+			wantQuery: &Query{
+				SQL:  "UPDATE `auto_time_model` SET `ctime`=?,`utime`=? WHERE `id` = ?;",
+				Args: []any{created, now.UnixMilli(), 1},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := tc.q.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, q)
+		})
+	}
+}
+
+// TestAutoTime_Rebuild 中间件和 dry-run 会多次构造语句，实体上的时间只在第一次构造的时候修改
+func TestAutoTime_Rebuild(t *testing.T) {
+	now := time.UnixMilli(1700000000123)
+	db := &DB{
+		core: core{
+			r:       model.NewRegistry(),
+			dialect: DialectMySOL,
+			creator: valuer.NewUnsafeValue,
+			clock: func() time.Time {
+				now = now.Add(time.Second)
+				return now
+			},
+		},
+	}
+	val := &AutoTimeModel{Id: 1}
+	u := NewUpdater[AutoTimeModel](db).Update(val).Set(C("Utime")).Where(C("Id").Eq(1))
+	q1, err := u.Build()
+	assert.NoError(t, err)
+	utime := val.Utime
+	q2, err := u.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, q1, q2)
+	assert.Equal(t, utime, val.Utime)
+
+	val = &AutoTimeModel{Id: 1}
+	i := NewInserter[AutoTimeModel](db).Values(val)
+	q1, err = i.Build()
+	assert.NoError(t, err)
+	utime = val.Utime
+	q2, err = i.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, q1, q2)
+	assert.Equal(t, utime, val.Utime)
+}
+
+func TestAutoTime_InvalidType(t *testing.T) {
+	_, err := model.NewRegistry().Register(&struct {
+		Ctime string `orm:"auto_create_time"`
+	}{})
+	assert.Equal(t, errs.NewErrInvalidAutoTime("Ctime", reflect.TypeOf("")), err)
+}
+
+type AutoTimeModel struct {
+	Id    int64
+	Ctime time.Time `orm:"auto_create_time"`
+	Utime int64     `orm:"auto_update_time=milli"`
+}
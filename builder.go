@@ -14,6 +14,13 @@ type builder struct {
 	quoter byte
 }
 
+// reset 清空上一次构造的结果，这样 Build 可以被多次调用，
+// 例如中间件里面先构造一次看看 SQL
+func (b *builder) reset() {
+	b.sb.Reset()
+	b.args = nil
+}
+
 // quote 构造列名 `col`
 func (b *builder) quote(name string) {
 	b.sb.WriteByte(b.quoter)
@@ -27,7 +34,7 @@ func (b *builder) buildColumn(col Column) error {
 	case nil:
 		fd, ok := b.model.FieldMap[col.name]
 		if !ok {
-			return errs.NewErrUnknownField(col.alias)
+			return errs.NewErrUnknownField(col.name)
 		}
 		//b.quote(fd.ColName)
 		b.sb.WriteByte('`')
@@ -45,7 +52,7 @@ func (b *builder) buildColumn(col Column) error {
 		}
 		fd, ok := m.FieldMap[col.name]
 		if !ok {
-			return errs.NewErrUnknownField(col.alias)
+			return errs.NewErrUnknownField(col.name)
 		}
 		if table.alias != "" {
 			b.quote(table.alias)
@@ -62,6 +69,86 @@ func (b *builder) buildColumn(col Column) error {
 	return nil
 }
 
+// buildExpression 构造表达式，WHERE、HAVING、ON 都是用它来构造的
+func (b *builder) buildExpression(expr Expression) error {
+	switch exp := expr.(type) {
+	// 如果是nil就执行就什么都不做
+	case nil:
+	// 如果是Predicate，说明是表达式，用递归不断筛选出合适的进行构造
+	case Predicate:
+		_, ok := exp.left.(Predicate)
+		if ok {
+			b.sb.WriteByte('(')
+		}
+		if err := b.buildExpression(exp.left); err != nil {
+			return err
+		}
+		if ok {
+			b.sb.WriteByte(')')
+		}
+
+		if exp.op != "" {
+			b.sb.WriteString(" " + exp.op.String() + " ")
+		}
+
+		// WHERE (`Age` = ?) AND (`name` = ?)
+		_, ok = exp.right.(Predicate)
+		if ok {
+			b.sb.WriteByte('(')
+		}
+		if err := b.buildExpression(exp.right); err != nil {
+			return err
+		}
+		if ok {
+			b.sb.WriteByte(')')
+		}
+
+	case Column:
+		// TODO
+		// 忽略别名
+		exp.alias = ""
+		return b.buildColumn(exp)
+
+	// 如果是值，我们就把它添加进args中，然后用占位符表示
+	// 防止SQL注入
+	case value:
+		b.addArgs(exp.val)
+		b.sb.WriteString("?")
+
+	case softDeleteExpr:
+		b.buildSoftDelete(exp)
+
+	case values:
+		b.sb.WriteByte('(')
+		for i, v := range exp.vals {
+			if i > 0 {
+				b.sb.WriteByte(',')
+			}
+			b.addArgs(v)
+			b.sb.WriteByte('?')
+		}
+		b.sb.WriteByte(')')
+
+	case RawExpr:
+		if len(exp.args) > 0 {
+			b.addArgs(exp.args...)
+		}
+		// 检查是否是聚合函数表达式
+		if isAggregateExpr(exp.raw) {
+			b.sb.WriteString(exp.raw)
+		} else {
+			// 用户自定义的 RawExpr，添加括号保证优先级
+			b.sb.WriteByte('(')
+			b.sb.WriteString(exp.raw)
+			b.sb.WriteByte(')')
+		}
+
+	default:
+		return errs.NewErrUnsupportedExpression(expr)
+	}
+	return nil
+}
+
 //func (b *builder) buildColumn(name string) error {
 //	fd, ok := b.model.FieldMap[name]
 //	if !ok {
@@ -0,0 +1,222 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Replica 从库
+type Replica struct {
+	DB *sql.DB
+	// Weight 权重，只有 WeightedBalancer 会使用，小于等于 0 的时候当作 1
+	Weight int
+	// down 健康检查失败之后会被摘掉，恢复之后重新加入
+	down atomic.Bool
+}
+
+// Balancer 从健康的从库里面挑一个出来，replicas 不会是空的
+type Balancer interface {
+	Pick(replicas []*Replica) *Replica
+}
+
+// Cluster 读写分离的 Session，包装一个主库和多个从库
+// 不在事务里面的查询会发到从库，写操作、事务里面的所有语句、
+// 加锁的查询以及原生 SQL 都会发到主库。
+// 方言、中间件这些配置都使用主库 DB 的
+type Cluster struct {
+	primary  *DB
+	replicas []*Replica
+	balancer Balancer
+}
+
+type ClusterOption func(c *Cluster)
+
+// NewCluster 大概用法：
+// cluster := NewCluster(db, []*Replica{{DB: r1}, {DB: r2}})
+// NewSelector[User](cluster).Get(ctx)
+func NewCluster(primary *DB, replicas []*Replica, opts ...ClusterOption) *Cluster {
+	res := &Cluster{
+		primary:  primary,
+		replicas: replicas,
+		balancer: NewRoundRobinBalancer(),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// ClusterWithBalancer 指定从库的负载均衡策略，默认是轮询
+func ClusterWithBalancer(b Balancer) ClusterOption {
+	return func(c *Cluster) {
+		c.balancer = b
+	}
+}
+
+// Primary 主库，开启事务也是在主库上
+func (c *Cluster) Primary() *DB {
+	return c.primary
+}
+
+// DoTx 在主库上执行事务闭包，fn 里面用 Cluster 执行的语句也在事务里面
+func (c *Cluster) DoTx(ctx context.Context, fn func(ctx context.Context, tx *Tx) error,
+	opts *sql.TxOptions, txOpts ...TxOption) error {
+	return c.primary.DoTx(ctx, fn, opts, txOpts...)
+}
+
+// BeginTx 在主库上开启事务
+func (c *Cluster) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	return c.primary.BeginTx(ctx, opts)
+}
+
+func (c *Cluster) getCore() core {
+	return c.primary.core
+}
+
+// queryContext context 里面有主库的事务的时候在事务里面执行，否则发到从库
+func (c *Cluster) queryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if tx, ok := c.primary.txFromContext(ctx); ok {
+		return tx.queryContext(ctx, query, args...)
+	}
+	return c.read(ctx, query, args...)
+}
+
+func (c *Cluster) execContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return c.primary.execContext(ctx, query, args...)
+}
+
+type primaryKey struct{}
+
+// UsePrimary 强制查询走主库，一般用在刚写入之后马上要读出来的场景，避免主从延迟
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func usePrimary(ctx context.Context) bool {
+	val, _ := ctx.Value(primaryKey{}).(bool)
+	return val
+}
+
+// reader 挑选执行查询的从库，返回 nil 表示走主库，
+// 没有健康的从库的时候也是退回到主库
+func (c *Cluster) reader(ctx context.Context) *Replica {
+	if len(c.replicas) == 0 || usePrimary(ctx) {
+		return nil
+	}
+	healthy := make([]*Replica, 0, len(c.replicas))
+	for _, r := range c.replicas {
+		if !r.down.Load() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	return c.balancer.Pick(healthy)
+}
+
+// read 在从库上查询，从库的连接出了问题就马上摘掉，然后在主库上重试
+// 不用等到下一次健康检查，避免这段时间里面的查询全部失败
+func (c *Cluster) read(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	r := c.reader(ctx)
+	if r == nil {
+		return c.primary.db.QueryContext(ctx, query, args...)
+	}
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err == nil || ctx.Err() != nil || !connErr(err) {
+		return rows, err
+	}
+	r.down.Store(true)
+	return c.primary.db.QueryContext(ctx, query, args...)
+}
+
+// connErr 连接层面的错误，语句本身的错误不算
+func connErr(err error) bool {
+	var ne net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.As(err, &ne)
+}
+
+// CheckReplicas 对所有从库执行一次健康检查，ping 失败的从库会被摘掉
+func (c *Cluster) CheckReplicas(ctx context.Context) {
+	for _, r := range c.replicas {
+		r.down.Store(r.DB.PingContext(ctx) != nil)
+	}
+}
+
+// StartHealthCheck 每隔 interval 检查一次从库，直到 ctx 被取消
+func (c *Cluster) StartHealthCheck(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkCtx, cancel := context.WithTimeout(ctx, interval)
+				c.CheckReplicas(checkCtx)
+				cancel()
+			}
+		}
+	}()
+}
+
+// RoundRobinBalancer 轮询
+type RoundRobinBalancer struct {
+	cnt atomic.Uint64
+}
+
+func NewRoundRobinBalancer() *RoundRobinBalancer {
+	return &RoundRobinBalancer{}
+}
+
+func (b *RoundRobinBalancer) Pick(replicas []*Replica) *Replica {
+	idx := b.cnt.Add(1) - 1
+	return replicas[idx%uint64(len(replicas))]
+}
+
+// RandomBalancer 随机
+type RandomBalancer struct{}
+
+func NewRandomBalancer() RandomBalancer {
+	return RandomBalancer{}
+}
+
+func (b RandomBalancer) Pick(replicas []*Replica) *Replica {
+	return replicas[rand.IntN(len(replicas))]
+}
+
+// WeightedBalancer 按照权重随机
+type WeightedBalancer struct{}
+
+func NewWeightedBalancer() WeightedBalancer {
+	return WeightedBalancer{}
+}
+
+func (b WeightedBalancer) Pick(replicas []*Replica) *Replica {
+	total := 0
+	for _, r := range replicas {
+		total += weightOf(r)
+	}
+	n := rand.IntN(total)
+	for _, r := range replicas {
+		n -= weightOf(r)
+		if n < 0 {
+			return r
+		}
+	}
+	return replicas[len(replicas)-1]
+}
+
+func weightOf(r *Replica) int {
+	if r.Weight <= 0 {
+		return 1
+	}
+	return r.Weight
+}
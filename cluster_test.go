@@ -0,0 +1,127 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+)
+
+func TestCluster(t *testing.T) {
+	primaryDB, primary, err := sqlmock.New()
+	require.NoError(t, err)
+	defer primaryDB.Close()
+	r1DB, r1, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer r1DB.Close()
+	r2DB, r2, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer r2DB.Close()
+
+	pdb, err := OpenDB(primaryDB)
+	require.NoError(t, err)
+	db := NewCluster(pdb, []*Replica{{DB: r1DB}, {DB: r2DB}})
+	ctx := context.Background()
+	get := func(ctx context.Context) {
+		_, _ = NewSelector[TestModel](db).Where(C("Id").Eq(1)).Get(ctx)
+	}
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id"}).AddRow(1)
+	}
+
+	// 轮询
+	r1.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	r2.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	r1.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	get(ctx)
+	get(ctx)
+	get(ctx)
+
+	// 写操作和强制主库的查询
+	primary.ExpectExec("DELETE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	primary.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	require.NoError(t, NewDeleter[TestModel](db).Where(C("Id").Eq(1)).Exec(ctx).Err())
+	get(UsePrimary(ctx))
+
+	// 事务里面的查询
+	primary.ExpectBegin()
+	primary.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	primary.ExpectCommit()
+	require.NoError(t, db.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+		get(ctx)
+		return nil
+	}, nil))
+
+	// r1 健康检查失败之后被摘掉
+	r1.ExpectPing().WillReturnError(errors.New("mock error"))
+	r2.ExpectPing()
+	db.CheckReplicas(ctx)
+	r2.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	r2.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	get(ctx)
+	get(ctx)
+
+	// 所有从库都不可用的时候退回主库
+	r2.ExpectPing().WillReturnError(errors.New("mock error"))
+	r1.ExpectPing().WillReturnError(errors.New("mock error"))
+	db.CheckReplicas(ctx)
+	primary.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	get(ctx)
+
+	// 恢复之后重新加入
+	r1.ExpectPing()
+	r2.ExpectPing()
+	db.CheckReplicas(ctx)
+	r1.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	r2.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	get(ctx)
+	get(ctx)
+
+	// 加锁的查询和原生 SQL 走主库
+	primary.ExpectQuery("SELECT .* FOR UPDATE;").WillReturnRows(rows())
+	primary.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	_, err = NewSelector[TestModel](db).Where(C("Id").Eq(1)).ForUpdate().Get(ctx)
+	require.NoError(t, err)
+	_, err = RawQuery[TestModel](db, "SELECT * FROM `test_model`").Get(ctx)
+	require.NoError(t, err)
+
+	// 从库的连接出错之后马上被摘掉，这一次查询在主库上重试
+	r2.ExpectQuery("SELECT .*").
+		WillReturnError(&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")})
+	primary.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	r1.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	r1.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	_, err = NewSelector[TestModel](db).Where(C("Id").Eq(1)).Get(ctx)
+	require.NoError(t, err)
+	get(ctx)
+	get(ctx)
+
+	// 语句本身的错误不会摘掉从库
+	r1.ExpectQuery("SELECT .*").WillReturnError(errors.New("mock error"))
+	get(ctx)
+	assert.False(t, db.replicas[0].down.Load())
+
+	// 直接用主库的 DB 不会读从库
+	primary.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	_, err = NewSelector[TestModel](pdb).Where(C("Id").Eq(1)).Get(ctx)
+	require.NoError(t, err)
+
+	assert.NoError(t, primary.ExpectationsWereMet())
+	assert.NoError(t, r1.ExpectationsWereMet())
+	assert.NoError(t, r2.ExpectationsWereMet())
+}
+
+func TestWeightedBalancer(t *testing.T) {
+	replicas := []*Replica{{Weight: 1}, {Weight: 0}, {Weight: 8}}
+	cnt := make(map[*Replica]int, len(replicas))
+	b := NewWeightedBalancer()
+	for i := 0; i < 1000; i++ {
+		cnt[b.Pick(replicas)]++
+	}
+	// 权重为 0 的当作 1
+	assert.Greater(t, cnt[replicas[1]], 0)
+	assert.Greater(t, cnt[replicas[2]], cnt[replicas[0]]+cnt[replicas[1]])
+}
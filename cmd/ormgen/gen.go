@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+	"web/orm/model"
+)
+
+// fileMeta 一个源文件里面需要生成代码的全部信息
+type fileMeta struct {
+	Package string
+	// RegisterFunc 生成的注册函数的名字
+	RegisterFunc string
+	// GenValue 是否生成 Field 和 FieldAddr 方法
+	GenValue bool
+	Types    []*typeMeta
+}
+
+// typeMeta 一个模型的信息
+type typeMeta struct {
+	Name      string
+	TableName string
+	// HasTableName 模型实现了 TableName 方法，生成的代码会直接调用它
+	HasTableName bool
+	Fields       []*fieldMeta
+	Relations    []*relationMeta
+	// SoftDelete 软删除字段的 Go 名字
+	SoftDelete string
+	// Version 版本号字段的 Go 名字
+	Version string
+	// AutoCreateTime 和 AutoUpdateTime 自动维护的时间字段的 Go 名字
+	AutoCreateTime string
+	AutoUpdateTime string
+}
+
+// fieldMeta 一个字段的信息
+type fieldMeta struct {
+	GoName  string
+	ColName string
+	// Milli 自动维护的时间字段使用毫秒
+	Milli bool
+}
+
+// relationMeta 一个关联字段的信息，校验和默认值直接复用 model 的解析
+type relationMeta struct {
+	*model.Relation
+	// TargetElem 从字段类型拿到结构体类型需要调用多少次 Elem
+	TargetElem string
+}
+
+// genOptions 生成代码的参数
+type genOptions struct {
+	// types 用来限定只为哪些结构体生成代码，为空的时候为所有导出的结构体生成
+	types []string
+	// registerFunc 注册函数的名字，同一个包里面有多个生成文件的时候需要区分
+	registerFunc string
+	// skipValue 不生成 Field 和 FieldAddr 方法
+	// 模型本身有同名字段或者方法的时候需要跳过
+	skipValue bool
+}
+
+// gen 解析 src 里面的结构体，把生成的代码写到 w 里面
+func gen(w io.Writer, filename string, src any, opts genOptions) error {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	fm, err := parseFile(f, opts.types)
+	if err != nil {
+		return err
+	}
+	fm.RegisterFunc = opts.registerFunc
+	if fm.RegisterFunc == "" {
+		fm.RegisterFunc = "RegisterModels"
+	}
+	fm.GenValue = !opts.skipValue
+	if len(fm.Types) == 0 {
+		return fmt.Errorf("ormgen: %s 中没有找到可以生成的结构体", filename)
+	}
+
+	buf := &bytes.Buffer{}
+	if err = tpl.Execute(buf, fm); err != nil {
+		return err
+	}
+	// 格式化一下，保证生成的代码符合 gofmt
+	bs, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bs)
+	return err
+}
+
+func parseFile(f *ast.File, types []string) (*fileMeta, error) {
+	want := make(map[string]bool, len(types))
+	for _, t := range types {
+		want[t] = true
+	}
+
+	// 先找出所有定义了 TableName 方法的类型
+	tableNames := make(map[string]bool, 4)
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || fn.Name.Name != "TableName" {
+			continue
+		}
+		tableNames[receiverName(fn.Recv.List[0].Type)] = true
+	}
+
+	res := &fileMeta{Package: f.Name.Name}
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			// 泛型结构体没办法确定字段类型，跳过
+			if !ok || ts.TypeParams != nil {
+				continue
+			}
+			name := ts.Name.Name
+			if len(want) > 0 {
+				if !want[name] {
+					continue
+				}
+			} else if !ast.IsExported(name) {
+				continue
+			}
+			tm, err := parseStruct(name, st)
+			if err != nil {
+				return nil, err
+			}
+			tm.HasTableName = tableNames[name]
+			res.Types = append(res.Types, tm)
+		}
+	}
+	return res, nil
+}
+
+func parseStruct(name string, st *ast.StructType) (*typeMeta, error) {
+	tm := &typeMeta{
+		Name:      name,
+		TableName: model.UnderscoreCase(name),
+	}
+	for _, fd := range st.Fields.List {
+		var tag reflect.StructTag
+		if fd.Tag != nil {
+			tag = reflect.StructTag(strings.Trim(fd.Tag.Value, "`"))
+		}
+		pair, err := model.ParseTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(fd.Names))
+		for _, n := range fd.Names {
+			names = append(names, n.Name)
+		}
+		// 组合，字段名就是类型名
+		if len(names) == 0 {
+			names = append(names, receiverName(fd.Type))
+		}
+		// 关联字段不是列
+		if _, ok := pair["rel"]; ok {
+			for _, n := range names {
+				rel, err := parseRelation(name, n, fd.Type, pair)
+				if err != nil {
+					return nil, err
+				}
+				tm.Relations = append(tm.Relations, rel)
+			}
+			continue
+		}
+		for _, n := range names {
+			ft := model.ParseFieldTag(n, pair)
+			if ft.SoftDelete {
+				tm.SoftDelete = n
+			}
+			if ft.Version {
+				tm.Version = n
+			}
+			if ft.AutoCreateTime {
+				tm.AutoCreateTime = n
+			}
+			if ft.AutoUpdateTime {
+				tm.AutoUpdateTime = n
+			}
+			tm.Fields = append(tm.Fields, &fieldMeta{
+				GoName:  n,
+				ColName: ft.ColName,
+				Milli:   ft.Milli,
+			})
+		}
+	}
+	return tm, nil
+}
+
+func parseRelation(owner, field string, typ ast.Expr, pair map[string]string) (*relationMeta, error) {
+	elem := ".Elem()"
+	_, slice := typ.(*ast.ArrayType)
+	if slice {
+		elem += ".Elem()"
+		typ = typ.(*ast.ArrayType).Elt
+	}
+	if _, ok := typ.(*ast.StarExpr); ok {
+		elem += ".Elem()"
+	}
+	rel, err := model.ParseRelation(owner, field, receiverName(typ), slice, pair)
+	if err != nil {
+		return nil, err
+	}
+	return &relationMeta{Relation: rel, TargetElem: elem}, nil
+}
+
+// receiverName 拿到 T、*T、pkg.T、[]*T 中的 T
+func receiverName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	case *ast.Ident:
+		return e.Name
+	case *ast.IndexExpr:
+		return receiverName(e.X)
+	case *ast.ArrayType:
+		return receiverName(e.Elt)
+	default:
+		return ""
+	}
+}
+
+var tpl = template.Must(template.New("ormgen").Parse(`// Code generated by ormgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"reflect"
+	"unsafe"
+	"web/orm"
+	"web/orm/model"
+)
+{{range $t := .Types}}
+// {{$t.Name}}Cols {{$t.Name}} 的列，写错字段名会直接编译失败
+var {{$t.Name}}Cols = struct {
+{{- range .Fields}}
+	{{.GoName}} orm.Column
+{{- end}}
+}{
+{{- range .Fields}}
+	{{.GoName}}: orm.C("{{.GoName}}"),
+{{- end}}
+}
+
+// {{$t.Name}}Model 预先构造好的 {{$t.Name}} 元数据
+func {{$t.Name}}Model() *model.Model {
+	t := &{{$t.Name}}{}
+	fields := []*model.Field{
+{{- range .Fields}}
+		{
+			GoName:  "{{.GoName}}",
+			ColName: "{{.ColName}}",
+			Type:    reflect.TypeOf(&t.{{.GoName}}).Elem(),
+			Offset:  unsafe.Offsetof(t.{{.GoName}}),
+			{{- if .Milli}}
+			Milli: true,
+			{{- end}}
+		},
+{{- end}}
+	}
+	fieldMap := make(map[string]*model.Field, len(fields))
+	columnMap := make(map[string]*model.Field, len(fields))
+	for _, fd := range fields {
+		fieldMap[fd.GoName] = fd
+		columnMap[fd.ColName] = fd
+	}
+	{{- if .Relations}}
+	relations := []*model.Relation{
+	{{- range .Relations}}
+		{
+			FieldName:  "{{.FieldName}}",
+			Type:       model.RelationType("{{.Type}}"),
+			Target:     reflect.TypeOf(&t.{{.FieldName}}){{.TargetElem}},
+			ForeignKey: "{{.ForeignKey}}",
+			References: "{{.References}}",
+			{{- if .JoinTable}}
+			JoinTable:      "{{.JoinTable}}",
+			JoinForeignKey: "{{.JoinForeignKey}}",
+			JoinReferences: "{{.JoinReferences}}",
+			TargetReferences: "{{.TargetReferences}}",
+			{{- end}}
+		},
+	{{- end}}
+	}
+	relationMap := make(map[string]*model.Relation, len(relations))
+	for _, rel := range relations {
+		relationMap[rel.FieldName] = rel
+	}
+	{{- end}}
+	return &model.Model{
+		{{- if $t.HasTableName}}
+		TableName: t.TableName(),
+		{{- else}}
+		TableName: "{{$t.TableName}}",
+		{{- end}}
+		Fields:    fields,
+		FieldMap:  fieldMap,
+		ColumnMap: columnMap,
+		{{- if .Relations}}
+		Relations:   relations,
+		RelationMap: relationMap,
+		{{- else}}
+		RelationMap: map[string]*model.Relation{},
+		{{- end}}
+		{{- if .SoftDelete}}
+		SoftDelete: fieldMap["{{.SoftDelete}}"],
+		{{- end}}
+		{{- if .Version}}
+		Version: fieldMap["{{.Version}}"],
+		{{- end}}
+		{{- if .AutoCreateTime}}
+		AutoCreateTime: fieldMap["{{.AutoCreateTime}}"],
+		{{- end}}
+		{{- if .AutoUpdateTime}}
+		AutoUpdateTime: fieldMap["{{.AutoUpdateTime}}"],
+		{{- end}}
+	}
+}
+{{- if $.GenValue}}
+
+// Field 直接读取字段，DB 会优先使用它而不是 unsafe 或者反射
+func (t *{{$t.Name}}) Field(name string) (any, error) {
+	switch name {
+{{- range .Fields}}
+	case "{{.GoName}}":
+		return t.{{.GoName}}, nil
+{{- end}}
+	default:
+		return nil, orm.NewErrUnknownField(name)
+	}
+}
+
+// FieldAddr 字段的地址，扫描结果集的时候使用
+// 列名和字段的对应关系以注册的元数据为准
+func (t *{{$t.Name}}) FieldAddr(name string) (any, error) {
+	switch name {
+{{- range .Fields}}
+	case "{{.GoName}}":
+		return &t.{{.GoName}}, nil
+{{- end}}
+	default:
+		return nil, orm.NewErrUnknownField(name)
+	}
+}
+{{- end}}
+{{end}}
+// {{.RegisterFunc}} 把本文件中所有模型的元数据登记到 r 中
+func {{.RegisterFunc}}(r model.Registry) error {
+{{- range .Types}}
+	if err := r.RegisterModel(&{{.Name}}{}, {{.Name}}Model()); err != nil {
+		return err
+	}
+{{- end}}
+	return nil
+}
+`))
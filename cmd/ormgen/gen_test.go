@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"web/orm/cmd/ormgen/testdata"
+	"web/orm/internal/errs"
+	"web/orm/model"
+)
+
+func TestGen(t *testing.T) {
+	want, err := os.ReadFile("testdata/user_orm_gen.go")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		filename string
+		src      any
+		opts     genOptions
+		wantCode string
+		wantErr  error
+	}{
+		{
+			name:     "user",
+			filename: "testdata/user.go",
+			wantCode: string(want),
+		},
+		{
+			name:     "invalid tag",
+			filename: "invalid.go",
+			src: `package testdata
+type User struct {
+	Id int64 ` + "`orm:\"column\"`" + `
+}`,
+			wantErr: errs.NewErrInvalidTagContent("column"),
+		},
+		{
+			name:     "invalid relation",
+			filename: "invalid.go",
+			src: `package testdata
+type User struct {
+	Orders *Order ` + "`orm:\"rel=has_many\"`" + `
+}`,
+			wantErr: errs.NewErrInvalidRelation("Orders", "必须是切片"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := gen(buf, tc.filename, tc.src, tc.opts)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantCode, buf.String())
+		})
+	}
+}
+
+// TestGen_Model 生成的元数据要和反射解析的完全一致
+func TestGen_Model(t *testing.T) {
+	testCases := []struct {
+		name   string
+		entity any
+		model  *model.Model
+	}{
+		{
+			name:   "user",
+			entity: &testdata.User{},
+			model:  testdata.UserModel(),
+		},
+		{
+			name:   "order",
+			entity: &testdata.Order{},
+			model:  testdata.OrderModel(),
+		},
+		{
+			name:   "role",
+			entity: &testdata.Role{},
+			model:  testdata.RoleModel(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			want, err := model.NewRegistry().Register(tc.entity)
+			require.NoError(t, err)
+			assert.Equal(t, want, tc.model)
+		})
+	}
+
+	r := model.NewRegistry()
+	require.NoError(t, testdata.RegisterModels(r))
+	m, err := r.Get(&testdata.User{})
+	require.NoError(t, err)
+	assert.Equal(t, "nick", m.FieldMap["NickName"].ColName)
+}
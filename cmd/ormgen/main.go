@@ -0,0 +1,48 @@
+// ormgen 根据模型定义生成类型安全的列和预先构造好的元数据
+//
+// 大概用法：在模型文件里面加上
+//
+//	//go:generate ormgen -src=$GOFILE
+//
+// 就会生成 xxx_orm_gen.go，里面有 UserCols.Age 这样的列，
+// RegisterModels(r model.Registry) 用于提前登记元数据，
+// 以及直接读写字段的 Field 和 FieldAddr 方法。
+// 扫描结果集的 SetColumn 不生成，由 valuer 按照注册的元数据调用 FieldAddr 完成，
+// 这样注册时修改的列名也能生效
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	src := flag.String("src", os.Getenv("GOFILE"), "模型所在的源文件")
+	out := flag.String("out", "", "生成的文件，默认是 <src>_orm_gen.go")
+	types := flag.String("type", "", "只为这些结构体生成代码，用逗号分隔")
+	fn := flag.String("func", "RegisterModels", "生成的注册函数的名字")
+	value := flag.Bool("value", true, "是否生成 Field 和 FieldAddr 方法")
+	flag.Parse()
+
+	if *src == "" {
+		log.Fatalln("ormgen: 没有指定 -src")
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(*src, ".go") + "_orm_gen.go"
+	}
+	opts := genOptions{registerFunc: *fn, skipValue: !*value}
+	if *types != "" {
+		opts.types = strings.Split(*types, ",")
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer f.Close()
+	if err = gen(f, *src, nil, opts); err != nil {
+		log.Fatalln(err)
+	}
+}
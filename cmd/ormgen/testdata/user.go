@@ -0,0 +1,36 @@
+package testdata
+
+import "database/sql"
+
+type User struct {
+	Id       int64
+	Age      int8
+	NickName string `orm:"column=nick"`
+	LastName *sql.NullString
+	Orders   []*Order `orm:"rel=has_many"`
+	Roles    []Role   `orm:"rel=many_to_many"`
+	Deleted  bool     `orm:"soft_delete"`
+	Ctime    int64    `orm:"auto_create_time=milli"`
+	Utime    int64    `orm:"auto_update_time"`
+}
+
+type Order struct {
+	Id      int64
+	UserId  int64
+	User    *User `orm:"rel=belongs_to"`
+	Version int64 `orm:"version"`
+}
+
+func (o *Order) TableName() string {
+	return "orders"
+}
+
+type Role struct {
+	Id   int64
+	Name string
+}
+
+// unexported 不会生成
+type unexported struct {
+	Id int64
+}
@@ -0,0 +1,338 @@
+// Code generated by ormgen. DO NOT EDIT.
+
+package testdata
+
+import (
+	"reflect"
+	"unsafe"
+	"web/orm"
+	"web/orm/model"
+)
+
+// UserCols User 的列，写错字段名会直接编译失败
+var UserCols = struct {
+	Id       orm.Column
+	Age      orm.Column
+	NickName orm.Column
+	LastName orm.Column
+	Deleted  orm.Column
+	Ctime    orm.Column
+	Utime    orm.Column
+}{
+	Id:       orm.C("Id"),
+	Age:      orm.C("Age"),
+	NickName: orm.C("NickName"),
+	LastName: orm.C("LastName"),
+	Deleted:  orm.C("Deleted"),
+	Ctime:    orm.C("Ctime"),
+	Utime:    orm.C("Utime"),
+}
+
+// UserModel 预先构造好的 User 元数据
+func UserModel() *model.Model {
+	t := &User{}
+	fields := []*model.Field{
+		{
+			GoName:  "Id",
+			ColName: "id",
+			Type:    reflect.TypeOf(&t.Id).Elem(),
+			Offset:  unsafe.Offsetof(t.Id),
+		},
+		{
+			GoName:  "Age",
+			ColName: "age",
+			Type:    reflect.TypeOf(&t.Age).Elem(),
+			Offset:  unsafe.Offsetof(t.Age),
+		},
+		{
+			GoName:  "NickName",
+			ColName: "nick",
+			Type:    reflect.TypeOf(&t.NickName).Elem(),
+			Offset:  unsafe.Offsetof(t.NickName),
+		},
+		{
+			GoName:  "LastName",
+			ColName: "last_name",
+			Type:    reflect.TypeOf(&t.LastName).Elem(),
+			Offset:  unsafe.Offsetof(t.LastName),
+		},
+		{
+			GoName:  "Deleted",
+			ColName: "deleted",
+			Type:    reflect.TypeOf(&t.Deleted).Elem(),
+			Offset:  unsafe.Offsetof(t.Deleted),
+		},
+		{
+			GoName:  "Ctime",
+			ColName: "ctime",
+			Type:    reflect.TypeOf(&t.Ctime).Elem(),
+			Offset:  unsafe.Offsetof(t.Ctime),
+			Milli:   true,
+		},
+		{
+			GoName:  "Utime",
+			ColName: "utime",
+			Type:    reflect.TypeOf(&t.Utime).Elem(),
+			Offset:  unsafe.Offsetof(t.Utime),
+		},
+	}
+	fieldMap := make(map[string]*model.Field, len(fields))
+	columnMap := make(map[string]*model.Field, len(fields))
+	for _, fd := range fields {
+		fieldMap[fd.GoName] = fd
+		columnMap[fd.ColName] = fd
+	}
+	relations := []*model.Relation{
+		{
+			FieldName:  "Orders",
+			Type:       model.RelationType("has_many"),
+			Target:     reflect.TypeOf(&t.Orders).Elem().Elem().Elem(),
+			ForeignKey: "UserId",
+			References: "Id",
+		},
+		{
+			FieldName:        "Roles",
+			Type:             model.RelationType("many_to_many"),
+			Target:           reflect.TypeOf(&t.Roles).Elem().Elem(),
+			ForeignKey:       "UserId",
+			References:       "Id",
+			JoinTable:        "user_role",
+			JoinForeignKey:   "user_id",
+			JoinReferences:   "role_id",
+			TargetReferences: "Id",
+		},
+	}
+	relationMap := make(map[string]*model.Relation, len(relations))
+	for _, rel := range relations {
+		relationMap[rel.FieldName] = rel
+	}
+	return &model.Model{
+		TableName:      "user",
+		Fields:         fields,
+		FieldMap:       fieldMap,
+		ColumnMap:      columnMap,
+		Relations:      relations,
+		RelationMap:    relationMap,
+		SoftDelete:     fieldMap["Deleted"],
+		AutoCreateTime: fieldMap["Ctime"],
+		AutoUpdateTime: fieldMap["Utime"],
+	}
+}
+
+// Field 直接读取字段，DB 会优先使用它而不是 unsafe 或者反射
+func (t *User) Field(name string) (any, error) {
+	switch name {
+	case "Id":
+		return t.Id, nil
+	case "Age":
+		return t.Age, nil
+	case "NickName":
+		return t.NickName, nil
+	case "LastName":
+		return t.LastName, nil
+	case "Deleted":
+		return t.Deleted, nil
+	case "Ctime":
+		return t.Ctime, nil
+	case "Utime":
+		return t.Utime, nil
+	default:
+		return nil, orm.NewErrUnknownField(name)
+	}
+}
+
+// FieldAddr 字段的地址，扫描结果集的时候使用
+// 列名和字段的对应关系以注册的元数据为准
+func (t *User) FieldAddr(name string) (any, error) {
+	switch name {
+	case "Id":
+		return &t.Id, nil
+	case "Age":
+		return &t.Age, nil
+	case "NickName":
+		return &t.NickName, nil
+	case "LastName":
+		return &t.LastName, nil
+	case "Deleted":
+		return &t.Deleted, nil
+	case "Ctime":
+		return &t.Ctime, nil
+	case "Utime":
+		return &t.Utime, nil
+	default:
+		return nil, orm.NewErrUnknownField(name)
+	}
+}
+
+// OrderCols Order 的列，写错字段名会直接编译失败
+var OrderCols = struct {
+	Id      orm.Column
+	UserId  orm.Column
+	Version orm.Column
+}{
+	Id:      orm.C("Id"),
+	UserId:  orm.C("UserId"),
+	Version: orm.C("Version"),
+}
+
+// OrderModel 预先构造好的 Order 元数据
+func OrderModel() *model.Model {
+	t := &Order{}
+	fields := []*model.Field{
+		{
+			GoName:  "Id",
+			ColName: "id",
+			Type:    reflect.TypeOf(&t.Id).Elem(),
+			Offset:  unsafe.Offsetof(t.Id),
+		},
+		{
+			GoName:  "UserId",
+			ColName: "user_id",
+			Type:    reflect.TypeOf(&t.UserId).Elem(),
+			Offset:  unsafe.Offsetof(t.UserId),
+		},
+		{
+			GoName:  "Version",
+			ColName: "version",
+			Type:    reflect.TypeOf(&t.Version).Elem(),
+			Offset:  unsafe.Offsetof(t.Version),
+		},
+	}
+	fieldMap := make(map[string]*model.Field, len(fields))
+	columnMap := make(map[string]*model.Field, len(fields))
+	for _, fd := range fields {
+		fieldMap[fd.GoName] = fd
+		columnMap[fd.ColName] = fd
+	}
+	relations := []*model.Relation{
+		{
+			FieldName:  "User",
+			Type:       model.RelationType("belongs_to"),
+			Target:     reflect.TypeOf(&t.User).Elem().Elem(),
+			ForeignKey: "UserId",
+			References: "Id",
+		},
+	}
+	relationMap := make(map[string]*model.Relation, len(relations))
+	for _, rel := range relations {
+		relationMap[rel.FieldName] = rel
+	}
+	return &model.Model{
+		TableName:   t.TableName(),
+		Fields:      fields,
+		FieldMap:    fieldMap,
+		ColumnMap:   columnMap,
+		Relations:   relations,
+		RelationMap: relationMap,
+		Version:     fieldMap["Version"],
+	}
+}
+
+// Field 直接读取字段，DB 会优先使用它而不是 unsafe 或者反射
+func (t *Order) Field(name string) (any, error) {
+	switch name {
+	case "Id":
+		return t.Id, nil
+	case "UserId":
+		return t.UserId, nil
+	case "Version":
+		return t.Version, nil
+	default:
+		return nil, orm.NewErrUnknownField(name)
+	}
+}
+
+// FieldAddr 字段的地址，扫描结果集的时候使用
+// 列名和字段的对应关系以注册的元数据为准
+func (t *Order) FieldAddr(name string) (any, error) {
+	switch name {
+	case "Id":
+		return &t.Id, nil
+	case "UserId":
+		return &t.UserId, nil
+	case "Version":
+		return &t.Version, nil
+	default:
+		return nil, orm.NewErrUnknownField(name)
+	}
+}
+
+// RoleCols Role 的列，写错字段名会直接编译失败
+var RoleCols = struct {
+	Id   orm.Column
+	Name orm.Column
+}{
+	Id:   orm.C("Id"),
+	Name: orm.C("Name"),
+}
+
+// RoleModel 预先构造好的 Role 元数据
+func RoleModel() *model.Model {
+	t := &Role{}
+	fields := []*model.Field{
+		{
+			GoName:  "Id",
+			ColName: "id",
+			Type:    reflect.TypeOf(&t.Id).Elem(),
+			Offset:  unsafe.Offsetof(t.Id),
+		},
+		{
+			GoName:  "Name",
+			ColName: "name",
+			Type:    reflect.TypeOf(&t.Name).Elem(),
+			Offset:  unsafe.Offsetof(t.Name),
+		},
+	}
+	fieldMap := make(map[string]*model.Field, len(fields))
+	columnMap := make(map[string]*model.Field, len(fields))
+	for _, fd := range fields {
+		fieldMap[fd.GoName] = fd
+		columnMap[fd.ColName] = fd
+	}
+	return &model.Model{
+		TableName:   "role",
+		Fields:      fields,
+		FieldMap:    fieldMap,
+		ColumnMap:   columnMap,
+		RelationMap: map[string]*model.Relation{},
+	}
+}
+
+// Field 直接读取字段，DB 会优先使用它而不是 unsafe 或者反射
+func (t *Role) Field(name string) (any, error) {
+	switch name {
+	case "Id":
+		return t.Id, nil
+	case "Name":
+		return t.Name, nil
+	default:
+		return nil, orm.NewErrUnknownField(name)
+	}
+}
+
+// FieldAddr 字段的地址，扫描结果集的时候使用
+// 列名和字段的对应关系以注册的元数据为准
+func (t *Role) FieldAddr(name string) (any, error) {
+	switch name {
+	case "Id":
+		return &t.Id, nil
+	case "Name":
+		return &t.Name, nil
+	default:
+		return nil, orm.NewErrUnknownField(name)
+	}
+}
+
+// RegisterModels 把本文件中所有模型的元数据登记到 r 中
+func RegisterModels(r model.Registry) error {
+	if err := r.RegisterModel(&User{}, UserModel()); err != nil {
+		return err
+	}
+	if err := r.RegisterModel(&Order{}, OrderModel()); err != nil {
+		return err
+	}
+	if err := r.RegisterModel(&Role{}, RoleModel()); err != nil {
+		return err
+	}
+	return nil
+}
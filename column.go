@@ -41,6 +41,16 @@ func (c Column) Gt(arg any) Predicate {
 	}
 }
 
+// In IN (?,?,?)
+// 大概用法：C("Id").In(1, 2, 3)
+func (c Column) In(args ...any) Predicate {
+	return Predicate{
+		left:  c,
+		op:    opIn,
+		right: values{vals: args},
+	}
+}
+
 func valueOf(arg any) Expression {
 	switch v := arg.(type) {
 	case Expression:
@@ -2,6 +2,11 @@ package orm
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"web/orm/internal/errs"
 	"web/orm/internal/valuer"
 	"web/orm/model"
 )
@@ -17,9 +22,16 @@ type core struct {
 	creator valuer.Creator
 	r       model.Registry
 	mdls    []Middleware
+	// clock 自动维护时间字段的时候使用的时钟，为 nil 的时候使用 time.Now
+	clock func() time.Time
+	// sharding 分库分表的配置，为 nil 表示没有分库分表
+	sharding *sharding
+	// dryRun 不为 nil 的时候只构造语句，记录下来之后直接返回，不会发给数据库
+	dryRun *Recorder
 }
 
 func get[T any](ctx context.Context, sess Session, c core, qc *QueryContext) *QueryResult {
+	qc.dialect = c.dialect
 	var root Handler = func(ctx context.Context, qc *QueryContext) *QueryResult {
 		return getHandler[T](ctx, sess, c, qc)
 	}
@@ -31,21 +43,34 @@ func get[T any](ctx context.Context, sess Session, c core, qc *QueryContext) *Qu
 
 func getHandler[T any](ctx context.Context, sess Session, c core, qc *QueryContext) *QueryResult {
 	// 构造查询
-	q, err := qc.Builder.Build()
+	q, err := qc.Query()
 	if err != nil {
 		return &QueryResult{
 			Err: err,
 		}
 	}
+	if r := c.recorder(ctx); r != nil {
+		r.record(qc, q)
+		return &QueryResult{
+			Err: ErrNoRows,
+		}
+	}
 
-	rows, err := sess.queryContext(ctx, q.SQL, q.Args)
+	rows, err := sess.queryContext(ctx, q.SQL, q.Args...)
 	if err != nil {
 		return &QueryResult{
-			Err: err,
+			Err: c.wrapErr(ctx, err),
 		}
 	}
+	defer rows.Close()
 
 	if !rows.Next() {
+		// 没有数据和读取出错都会返回 false，例如读到一半超时了
+		if err = rows.Err(); err != nil {
+			return &QueryResult{
+				Err: c.wrapErr(ctx, err),
+			}
+		}
 		return &QueryResult{
 			Err: ErrNoRows,
 		}
@@ -55,11 +80,106 @@ func getHandler[T any](ctx context.Context, sess Session, c core, qc *QueryConte
 	err = val.SetColumn(rows)
 	return &QueryResult{
 		Result: tp,
-		Err:    err,
+		Err:    c.wrapErr(ctx, err),
+	}
+}
+
+func getMulti[T any](ctx context.Context, sess Session, c core, qc *QueryContext) *QueryResult {
+	qc.Multi = true
+	qc.dialect = c.dialect
+	var root Handler = func(ctx context.Context, qc *QueryContext) *QueryResult {
+		return getMultiHandler[T](ctx, sess, c, qc)
+	}
+	for i := len(c.mdls) - 1; i >= 0; i-- {
+		root = c.mdls[i](root)
 	}
+	return root(ctx, qc)
+}
+
+func getMultiHandler[T any](ctx context.Context, sess Session, c core, qc *QueryContext) *QueryResult {
+	q, err := qc.Query()
+	if err != nil {
+		return &QueryResult{
+			Err: err,
+		}
+	}
+	if r := c.recorder(ctx); r != nil {
+		r.record(qc, q)
+		return &QueryResult{
+			Result: []*T{},
+		}
+	}
+
+	rows, err := sess.queryContext(ctx, q.SQL, q.Args...)
+	if err != nil {
+		return &QueryResult{
+			Err: c.wrapErr(ctx, err),
+		}
+	}
+	defer rows.Close()
+
+	// 用来装数据
+	var result []*T
+	for rows.Next() {
+		tp := new(T)
+		// 交给 Value 抽象处理列的顺序和赋值
+		val := c.creator(c.model, tp)
+		if err = val.SetColumn(rows); err != nil {
+			return &QueryResult{
+				Err: c.wrapErr(ctx, err),
+			}
+		}
+		result = append(result, tp)
+	}
+	return &QueryResult{
+		Result: result,
+		Err:    c.wrapErr(ctx, rows.Err()),
+	}
+}
+
+// queryRows 查询多行，scan 负责把结果集转换成 Result
+// 预加载的时候子模型的类型只有在运行时才知道，没有办法使用 getMulti
+func queryRows(ctx context.Context, sess Session, c core, qc *QueryContext,
+	scan func(rows *sql.Rows) (any, error)) *QueryResult {
+	qc.Multi = true
+	qc.dialect = c.dialect
+	var root Handler = func(ctx context.Context, qc *QueryContext) *QueryResult {
+		q, err := qc.Query()
+		if err != nil {
+			return &QueryResult{
+				Err: err,
+			}
+		}
+		if r := c.recorder(ctx); r != nil {
+			r.record(qc, q)
+			return &QueryResult{}
+		}
+
+		rows, err := sess.queryContext(ctx, q.SQL, q.Args...)
+		if err != nil {
+			return &QueryResult{
+				Err: c.wrapErr(ctx, err),
+			}
+		}
+		defer rows.Close()
+
+		res, err := scan(rows)
+		if err == nil {
+			err = rows.Err()
+		}
+		return &QueryResult{
+			Result: res,
+			Err:    c.wrapErr(ctx, err),
+		}
+	}
+	for i := len(c.mdls) - 1; i >= 0; i-- {
+		root = c.mdls[i](root)
+	}
+	return root(ctx, qc)
 }
 
 func exec(ctx context.Context, sess Session, c core, qc *QueryContext) *QueryResult {
+	qc.dialect = c.dialect
 	var root Handler = func(ctx context.Context, qc *QueryContext) *QueryResult {
 		return execHandler(ctx, sess, c, qc)
 	}
@@ -70,19 +190,45 @@ func exec(ctx context.Context, sess Session, c core, qc *QueryContext) *QueryRes
 }
 
 func execHandler(ctx context.Context, sess Session, c core, qc *QueryContext) *QueryResult {
-	q, err := qc.Builder.Build()
+	q, err := qc.Query()
 	if err != nil {
 		return &QueryResult{
 			Result: Result{
 				err: err,
 			},
+			Err: err,
+		}
+	}
+	if r := c.recorder(ctx); r != nil {
+		r.record(qc, q)
+		return &QueryResult{
+			Result: Result{
+				res: dryRunResult{},
+			},
 		}
 	}
 	res, err := sess.execContext(ctx, q.SQL, q.Args...)
+	err = c.wrapErr(ctx, err)
 	return &QueryResult{
 		Result: Result{
 			err: err,
 			res: res,
 		},
+		Err: err,
+	}
+}
+
+// wrapErr 超时的错误统一包装成 ErrQueryTimeout，其它错误保持原样
+func (c core) wrapErr(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, ErrQueryTimeout) {
+		return err
+	}
+	// 有的驱动在 context 结束的时候返回自己的错误，这里统一带上 context 的错误
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		err = fmt.Errorf("%w：%w", ctxErr, err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) || c.dialect.timeout(err) {
+		return errs.NewErrQueryTimeout(err)
 	}
+	return err
 }
@@ -35,7 +35,7 @@ func OpenDB(db *sql.DB, opts ...DBOption) (*DB, error) {
 	res := &DB{
 		core: core{
 			r:       model.NewRegistry(),
-			creator: valuer.NewUnsafeValue,
+			creator: valuer.WithGenerated(valuer.NewUnsafeValue),
 			dialect: DialectMySOL,
 		},
 		db: db,
@@ -51,12 +51,39 @@ func (db *DB) getCore() core {
 }
 
 // DoTx 事务闭包
+// 默认是 PropagationRequired，context 里面已经有这个 DB 的事务的时候直接加入，
+// 这个时候 opts 不会生效，提交还是回滚也由外层决定。
+// fn 拿到的 ctx 里面带着事务，所以 fn 里面用 DB 执行的语句也在事务里面
 func (db *DB) DoTx(ctx context.Context, fn func(ctx context.Context, tx *Tx) error,
+	opts *sql.TxOptions, txOpts ...TxOption) (err error) {
+	o := txOptions{propagation: PropagationRequired}
+	for _, opt := range txOpts {
+		opt(&o)
+	}
+	if tx, ok := db.txFromContext(ctx); ok {
+		switch o.propagation {
+		case PropagationRequired, PropagationSupported:
+			return fn(ctx, tx)
+		case PropagationNested:
+			return tx.DoTx(ctx, fn)
+		}
+	} else if o.propagation == PropagationSupported {
+		return fn(ctx, nil)
+	}
+	if o.retry != nil {
+		return db.doTxWithRetry(ctx, fn, opts, o.retry)
+	}
+	return db.doTx(ctx, fn, opts)
+}
+
+// doTx 开启一个新的事务执行 fn
+func (db *DB) doTx(ctx context.Context, fn func(ctx context.Context, tx *Tx) error,
 	opts *sql.TxOptions) (err error) {
 	tx, err := db.BeginTx(ctx, opts)
 	if err != nil {
 		return
 	}
+	ctx = WithTx(ctx, tx)
 	panicked := true
 	defer func() {
 		if panicked || err != nil {
@@ -78,14 +105,21 @@ func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Tx{tx: tx}, nil
+	return &Tx{tx: tx, db: db, ctx: ctx}, nil
 }
 
+// queryContext context 里面有事务的时候在事务里面执行
 func (db *DB) queryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if tx, ok := db.txFromContext(ctx); ok {
+		return tx.queryContext(ctx, query, args...)
+	}
 	return db.db.QueryContext(ctx, query, args...)
 }
 
 func (db *DB) execContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if tx, ok := db.txFromContext(ctx); ok {
+		return tx.execContext(ctx, query, args...)
+	}
 	return db.db.ExecContext(ctx, query, args...)
 }
 
@@ -97,7 +131,7 @@ func DBWithDialect(dialect Dialect) DBOption {
 
 func DBUseReflect() DBOption {
 	return func(r *DB) {
-		r.creator = valuer.NewReflectValue
+		r.creator = valuer.WithGenerated(valuer.NewReflectValue)
 	}
 }
 
@@ -125,3 +159,18 @@ func (db *DB) Wait() error {
 	}
 	return err
 }
+
+// DBWithRegistry 使用外部的元数据注册中心
+// 一般配合代码生成的 RegisterModels 使用，提前登记好元数据
+func DBWithRegistry(r model.Registry) DBOption {
+	return func(db *DB) {
+		db.r = r
+	}
+}
+
+// DBWithClock 指定自动维护时间字段以及软删除使用的时钟，一般用于测试
+func DBWithClock(clock func() time.Time) DBOption {
+	return func(db *DB) {
+		db.clock = clock
+	}
+}
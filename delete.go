@@ -1,37 +1,49 @@
 package orm
 
 import (
-	"strings"
+	"context"
+	"database/sql"
 	"web/orm/internal/errs"
-	"web/orm/model"
 )
 
 type Deleter[T any] struct {
+	builder
 	table string
 	// 在where下面有各种条件
 	where []Predicate
-	model *model.Model
-	sb    strings.Builder
-	args  []any
-	db    *DB
+	sess  Session
+	// hard 为 true 的时候，即便模型支持软删除也物理删除
+	hard bool
 }
 
-func NewDeleter[T any](db *DB) *Deleter[T] {
+func NewDeleter[T any](sess Session) *Deleter[T] {
+	c := sess.getCore()
 	return &Deleter[T]{
-		db: db,
-		sb: strings.Builder{},
+		builder: builder{
+			core:   c,
+			quoter: c.dialect.quoter(),
+		},
+		sess: sess,
 	}
 }
 
 func (d *Deleter[T]) Build() (*Query, error) {
-	// 先构造最基础的东西
-	d.sb.WriteString("DELETE FROM ")
+	d.reset()
 	// 解析model，获取表名
 	var err error
-	d.model, err = d.db.r.Get(new(T))
+	d.model, err = d.r.Get(new(T))
 	if err != nil {
 		return nil, err
 	}
+	soft := !d.hard && d.model.SoftDelete != nil
+
+	// 先构造最基础的东西
+	// 软删除的模型，删除就是把软删除字段更新一下
+	if soft {
+		d.sb.WriteString("UPDATE ")
+	} else {
+		d.sb.WriteString("DELETE FROM ")
+	}
 	// 把表名加到里面
 	if d.table != "" {
 		d.sb.WriteByte('`')
@@ -43,87 +55,49 @@ func (d *Deleter[T]) Build() (*Query, error) {
 		d.sb.WriteByte('`')
 	}
 
-	// 串联，构造Where语句
-	if len(d.where) > 0 {
-		d.sb.WriteString(" WHERE ")
-		// 然后进行串联
-		p := d.where[0]
-		for _, w := range d.where[1:] {
-			p = p.And(w)
-		}
-
-		// 串联完成之后，进行构造环节
-		if err = d.buildExpression(p); err != nil {
-			return nil, err
-		}
-
-		d.sb.WriteByte(';')
-	} else {
+	if len(d.where) == 0 {
 		return &Query{
 			SQL: d.sb.String(),
 		}, errs.ErrDeleteALL
 	}
 
-	return &Query{
-		SQL:  d.sb.String(),
-		Args: d.args,
-	}, nil
-}
-
-// buildExpression
-// 我们传入的是Predicate 或者 Column，它们都实现了Expression接口，顶级抽象
-func (d *Deleter[T]) buildExpression(expr Expression) error {
-	switch exp := expr.(type) {
-	case nil:
-	// C("id").Eq(12).And(C("name").Eq("Tom"))
-	// `id` = 12 AND `name` = "Tom"
-	case Predicate:
-		// 构造完左边的Predicate
-		_, ok := exp.left.(Predicate)
-		if ok {
-			d.sb.WriteByte('(')
-		}
-		if err := d.buildExpression(exp.left); err != nil {
-			return err
-		}
-		if ok {
-			d.sb.WriteByte(')')
-		}
-
-		// 构造中间的表达式或者是 OP
-		d.sb.WriteString(" " + exp.op.String() + " ")
-
-		// 最后构造右边的Predicate
-		_, ok = exp.right.(Predicate)
-		if ok {
-			d.sb.WriteByte('(')
-		}
-		if err := d.buildExpression(exp.right); err != nil {
-			return err
-		}
-		if ok {
-			d.sb.WriteByte(')')
-		}
-
-	// 如果是一个列名：就构造成 `age` =
-	case Column:
-		d.sb.WriteByte('`')
-		fd, ok := d.model.FieldMap[exp.name]
-		if !ok {
-			return errs.NewErrUnknownField(exp.name)
+	if soft {
+		now := d.now()
+		d.sb.WriteString(" SET ")
+		d.quote(d.model.SoftDelete.ColName)
+		d.sb.WriteString("=?")
+		d.addArgs(softDeleteValue(d.model.SoftDelete, now))
+		// 软删除也是一次更新，要维护更新时间
+		if fd := d.model.AutoUpdateTime; fd != nil {
+			d.sb.WriteByte(',')
+			d.quote(fd.ColName)
+			d.sb.WriteString("=?")
+			d.addArgs(autoTimeValue(fd, now))
 		}
-		d.sb.WriteString(fd.ColName)
-		d.sb.WriteByte('`')
+	}
 
-	// 如果解析到最后，发现是一个参数，我们就要存储起来
-	case value:
-		d.args = append(d.args, exp.val)
-		d.sb.WriteByte('?')
+	// 串联，构造Where语句
+	d.sb.WriteString(" WHERE ")
+	// 然后进行串联
+	p := d.where[0]
+	for _, w := range d.where[1:] {
+		p = p.And(w)
+	}
+	// 已经删除过的就不需要再更新一遍了
+	if soft {
+		p = p.And(notDeleted("", d.model))
+	}
 
-	default:
-		return errs.NewErrUnsupportedExpression(expr)
+	// 串联完成之后，进行构造环节
+	if err = d.buildExpression(p); err != nil {
+		return nil, err
 	}
-	return nil
+
+	d.sb.WriteByte(';')
+	return &Query{
+		SQL:  d.sb.String(),
+		Args: d.args,
+	}, nil
 }
 
 // Where 让用户传表达式进来，然后我们自己构造
@@ -136,3 +110,47 @@ func (d *Deleter[T]) From(table string) *Deleter[T] {
 	d.table = table
 	return d
 }
+
+// HardDelete 物理删除，忽略模型上的软删除字段
+func (d *Deleter[T]) HardDelete() *Deleter[T] {
+	d.hard = true
+	return d
+}
+
+// Exec 执行
+func (d *Deleter[T]) Exec(ctx context.Context) Result {
+	var err error
+	d.model, err = d.r.Get(new(T))
+	if err != nil {
+		return Result{
+			err: err,
+		}
+	}
+	ctx = withSession(ctx, d.sess)
+	if h, ok := any(new(T)).(BeforeDeleteHook); ok {
+		if err = h.BeforeDelete(ctx, d.where); err != nil {
+			return Result{
+				err: err,
+			}
+		}
+	}
+	var res *QueryResult
+	if algo, ok := shardingAlgo[T](d.core); ok {
+		res = d.shardingExec(ctx, algo)
+	} else {
+		res = exec(ctx, d.sess, d.core, &QueryContext{
+			Type:    "DELETE",
+			Builder: d,
+			Model:   d.model,
+		})
+	}
+
+	var sqlRes sql.Result
+	if res.Result != nil {
+		sqlRes = res.Result.(sql.Result)
+	}
+	return Result{
+		err: res.Err,
+		res: sqlRes,
+	}
+}
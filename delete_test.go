@@ -3,6 +3,7 @@ package orm
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 	"web/orm/internal/errs"
 	"web/orm/internal/valuer"
 	"web/orm/model"
@@ -25,10 +26,8 @@ func TestDeleter_Build(t *testing.T) {
 		wantQuery *Query
 	}{
 		{
-			name: "success",
-			builder: (&Deleter[TestModel]{
-				db: r,
-			}).Where(C("Age").Eq(12)),
+			name:    "success",
+			builder: NewDeleter[TestModel](r).Where(C("Age").Eq(12)),
 			wantErr: nil,
 			wantQuery: &Query{
 				SQL:  "DELETE FROM `test_model` WHERE `age` = ?;",
@@ -36,10 +35,8 @@ func TestDeleter_Build(t *testing.T) {
 			},
 		},
 		{
-			name: "delete from",
-			builder: (&Deleter[TestModel]{
-				db: r,
-			}).From("`TestModel`"),
+			name:    "delete from",
+			builder: NewDeleter[TestModel](r).From("`TestModel`"),
 			wantQuery: &Query{
 				SQL:  "DELETE FROM `TestModel`;",
 				Args: nil,
@@ -47,10 +44,8 @@ func TestDeleter_Build(t *testing.T) {
 			wantErr: errs.ErrDeleteALL,
 		},
 		{
-			name: "empty from",
-			builder: (&Deleter[TestModel]{
-				db: r,
-			}).From(""),
+			name:    "empty from",
+			builder: NewDeleter[TestModel](r).From(""),
 			wantQuery: &Query{
 				SQL:  "DELETE FROM `test_model`;",
 				Args: nil,
@@ -58,10 +53,8 @@ func TestDeleter_Build(t *testing.T) {
 			wantErr: errs.ErrDeleteALL,
 		},
 		{
-			name: "long where",
-			builder: (&Deleter[TestModel]{
-				db: r,
-			}).Where(C("Age").Eq(12).And(C("FirstName").Eq("John"))),
+			name:    "long where",
+			builder: NewDeleter[TestModel](r).Where(C("Age").Eq(12).And(C("FirstName").Eq("John"))),
 			wantQuery: &Query{
 				SQL:  "DELETE FROM `test_model` WHERE (`age` = ?) AND (`first_name` = ?);",
 				Args: []any{12, "John"},
@@ -69,7 +62,7 @@ func TestDeleter_Build(t *testing.T) {
 		},
 		{
 			name:    "Not",
-			builder: (&Deleter[TestModel]{db: r}).Where(Not(C("Age").Eq(12))),
+			builder: NewDeleter[TestModel](r).Where(Not(C("Age").Eq(12))),
 			wantQuery: &Query{
 				SQL:  "DELETE FROM `test_model` WHERE  NOT (`age` = ?);",
 				Args: []any{12},
@@ -77,7 +70,7 @@ func TestDeleter_Build(t *testing.T) {
 		},
 		{
 			name:    "invalid column",
-			builder: (&Deleter[TestModel]{db: r}).Where(C("InvalidColumn").Eq(12)),
+			builder: NewDeleter[TestModel](r).Where(C("InvalidColumn").Eq(12)),
 			wantErr: errs.NewErrUnknownField("InvalidColumn"),
 		},
 	}
@@ -93,3 +86,87 @@ func TestDeleter_Build(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleter_SoftDelete(t *testing.T) {
+	now := time.UnixMilli(1700000000123)
+	db := &DB{
+		core: core{
+			r:       model.NewRegistry(),
+			creator: valuer.NewReflectValue,
+			dialect: DialectMySOL,
+			clock:   func() time.Time { return now },
+		},
+	}
+	testCases := []struct {
+		name      string
+		builder   DeleteBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name:    "soft delete",
+			builder: NewDeleter[SoftDeleteModel](db).Where(C("Id").Eq(12)),
+			wantQuery: &Query{
+				SQL:  "UPDATE `soft_delete_model` SET `deleted`=? WHERE (`id` = ?) AND (`deleted` = ?);",
+				Args: []any{true, 12, false},
+			},
+		},
+		{
+			name:    "time",
+			builder: NewDeleter[SoftDeleteTimeModel](db).Where(C("Id").Eq(12)),
+			wantQuery: &Query{
+				SQL:  "UPDATE `soft_delete_time_model` SET `deleted_at`=? WHERE (`id` = ?) AND (`deleted_at` IS NULL);",
+				Args: []any{now, 12},
+			},
+		},
+		{
+			name:    "int flag and auto update time",
+			builder: NewDeleter[SoftDeleteFlagModel](db).Where(C("Id").Eq(12)),
+			wantQuery: &Query{
+				SQL:  "UPDATE `soft_delete_flag_model` SET `deleted`=?,`updated_at`=? WHERE (`id` = ?) AND (`deleted` = ?);",
+				Args: []any{1, now.UnixMilli(), 12, int8(0)},
+			},
+		},
+		{
+			name:    "hard delete",
+			builder: NewDeleter[SoftDeleteModel](db).Where(C("Id").Eq(12)).HardDelete(),
+			wantQuery: &Query{
+				SQL:  "DELETE FROM `soft_delete_model` WHERE `id` = ?;",
+				Args: []any{12},
+			},
+		},
+		{
+			name:    "soft delete all",
+			builder: NewDeleter[SoftDeleteModel](db),
+			wantErr: errs.ErrDeleteALL,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := tc.builder.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, q)
+		})
+	}
+}
+
+type SoftDeleteModel struct {
+	Id      int64
+	Name    string
+	Deleted bool `orm:"soft_delete"`
+}
+
+type SoftDeleteFlagModel struct {
+	Id        int64
+	Deleted   int8  `orm:"soft_delete"`
+	UpdatedAt int64 `orm:"auto_update_time=milli"`
+}
+
+type SoftDeleteTimeModel struct {
+	Id        int64
+	DeletedAt *time.Time `orm:"soft_delete"`
+}
@@ -1,6 +1,10 @@
 package orm
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 	"web/orm/internal/errs"
 )
 
@@ -16,6 +20,28 @@ type Dialect interface {
 	// 构造OnDuplicateKey
 	// 这里用 *builder是因为builder里面有strings.Builder
 	buildOnDuplicateKey(b *builder, odk *Upsert) error
+
+	// savepoint 创建保存点，releaseSavepoint 释放保存点，
+	// rollbackToSavepoint 回滚到保存点，都是返回对应的 SQL
+	savepoint(name string) string
+	releaseSavepoint(name string) string
+	rollbackToSavepoint(name string) string
+
+	// retryable 判断事务遇到的错误能不能通过重试解决，例如死锁
+	// 方法没有导出，自定义的方言没办法修改，自己判断的话用 RetryPolicy.Retryable
+	retryable(err error) bool
+
+	// lockClause 查询加锁的子句，带着前面的空格
+	lockClause(skipLocked bool) string
+
+	// timeout 判断是不是数据库那边因为执行时间限制中断了语句
+	timeout(err error) bool
+	// executionTimeHint 限制 SELECT 执行时间的提示，紧跟在 SELECT 后面，带着后面的空格
+	// 不支持的方言返回空字符串，只依赖 context 的超时
+	executionTimeHint(d time.Duration) string
+
+	// stringLiteral 转义之后用单引号包裹的字符串，只用于 Query.Interpolate
+	stringLiteral(s string) string
 }
 
 type standardSQL struct {
@@ -31,13 +57,104 @@ func (s standardSQL) buildOnDuplicateKey(b *builder, odk *Upsert) error {
 	panic("implement me")
 }
 
+func (s standardSQL) savepoint(name string) string {
+	return "SAVEPOINT " + name + ";"
+}
+
+func (s standardSQL) releaseSavepoint(name string) string {
+	return "RELEASE SAVEPOINT " + name + ";"
+}
+
+func (s standardSQL) rollbackToSavepoint(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name + ";"
+}
+
+func (s standardSQL) lockClause(skipLocked bool) string {
+	if skipLocked {
+		return " FOR UPDATE SKIP LOCKED"
+	}
+	return " FOR UPDATE"
+}
+
+// sqlStateErr 驱动的错误上如果有 SQLSTATE 就用它来判断，例如 pgx 和 lib/pq
+type sqlStateErr interface {
+	SQLState() string
+}
+
+// retryable 40001 序列化失败，40P01 死锁，55P03 锁等待超时
+func (s standardSQL) retryable(err error) bool {
+	var se sqlStateErr
+	if !errors.As(err, &se) {
+		return false
+	}
+	switch se.SQLState() {
+	case "40001", "40P01", "55P03":
+		return true
+	}
+	return false
+}
+
+func (s standardSQL) timeout(err error) bool {
+	return false
+}
+
+func (s standardSQL) executionTimeHint(d time.Duration) string {
+	return ""
+}
+
+func (s standardSQL) stringLiteral(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", "''") + "'"
+}
+
+// mysqlDialect 保存点的语法和标准 SQL 是一样的
 type mysqlDialect struct {
+	standardSQL
 }
 
 func (m mysqlDialect) quoter() byte {
 	return '`'
 }
 
+// retryable 1213 死锁，1205 锁等待超时
+func (m mysqlDialect) retryable(err error) bool {
+	if num, ok := mysqlErrNumber(err); ok {
+		return num == 1213 || num == 1205
+	}
+	return m.standardSQL.retryable(err)
+}
+
+// timeout 3024 超过了 MAX_EXECUTION_TIME
+func (m mysqlDialect) timeout(err error) bool {
+	num, ok := mysqlErrNumber(err)
+	return ok && num == 3024
+}
+
+// mysqlNumberErr 错误上有 MySQL 错误码的驱动可以实现这个接口。
+// go-sql-driver/mysql 的 *MySQLError 只有 Number 字段，没有实现，
+// 用这个驱动的时候死锁重试需要通过 RetryPolicy.Retryable 自己判断
+type mysqlNumberErr interface {
+	ErrorNumber() uint16
+}
+
+// mysqlErrNumber 沿着错误链找 MySQL 的错误码
+func mysqlErrNumber(err error) (uint16, bool) {
+	var ne mysqlNumberErr
+	if errors.As(err, &ne) {
+		return ne.ErrorNumber(), true
+	}
+	return 0, false
+}
+
+// executionTimeHint 单位是毫秒，只对只读的 SELECT 生效
+func (m mysqlDialect) executionTimeHint(d time.Duration) string {
+	return fmt.Sprintf("/*+ MAX_EXECUTION_TIME(%d) */ ", max(d.Milliseconds(), 1))
+}
+
+// stringLiteral 默认的 SQL 模式下反斜杠也是转义字符
+func (m mysqlDialect) stringLiteral(str string) string {
+	return m.standardSQL.stringLiteral(strings.ReplaceAll(str, `\`, `\\`))
+}
+
 func (m mysqlDialect) buildOnDuplicateKey(b *builder, odk *Upsert) error {
 	b.sb.WriteString(" ON DUPLICATE KEY UPDATE ")
 	for idx, assign := range odk.assigns {
@@ -74,6 +191,16 @@ type SQLiteDialect struct {
 	standardSQL
 }
 
+// quoter SQLite 也支持用反引号包裹标识符
+func (s SQLiteDialect) quoter() byte {
+	return '`'
+}
+
+// lockClause SQLite 没有行锁，写事务本身就会锁住整个数据库
+func (s SQLiteDialect) lockClause(skipLocked bool) string {
+	return ""
+}
+
 // buildOnDuplicateKey SQLite的语法大概是：
 // INSERT INTO table_name (column1, column2)
 // VALUES (value1, value2)
@@ -84,12 +211,12 @@ type SQLiteDialect struct {
 //
 // 使用 excluded 关键字引用插入的新值（相当于 MySQL 的 VALUES ）
 func (s SQLiteDialect) buildOnDuplicateKey(b *builder, odk *Upsert) error {
-	b.sb.WriteString("ON CONFLICT (")
+	b.sb.WriteString(" ON CONFLICT (")
 	for i, col := range odk.conflictColumns {
 		if i > 0 {
 			b.sb.WriteByte(',')
 		}
-		err := b.buildColumn(col)
+		err := b.buildColumn(C(col))
 		if err != nil {
 			return err
 		}
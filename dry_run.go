@@ -0,0 +1,102 @@
+package orm
+
+import (
+	"context"
+	"sync"
+)
+
+// Recorder dry-run 模式下记录构造好的语句，语句不会发给数据库。
+// 中间件照常执行，记录的是经过中间件修改之后的最终语句。
+// Get 返回 ErrNoRows，GetMulti 返回空切片，Exec 的影响行数和自增主键都是 0，
+// 带版本号的更新不检查乐观锁，实体上的版本号也不会变
+type Recorder struct {
+	mu      sync.Mutex
+	queries []RecordedQuery
+}
+
+// RecordedQuery 记录下来的一条语句
+type RecordedQuery struct {
+	// Type 和 QueryContext.Type 一样，例如 SELECT、RAW
+	Type  string
+	Table string
+	SQL   string
+	Args  []any
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Queries 按照执行顺序返回记录下来的语句
+func (r *Recorder) Queries() []RecordedQuery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]RecordedQuery, len(r.queries))
+	copy(res, r.queries)
+	return res
+}
+
+// SQLs 只返回 SQL，方便在测试里面断言
+func (r *Recorder) SQLs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]string, 0, len(r.queries))
+	for _, q := range r.queries {
+		res = append(res, q.SQL)
+	}
+	return res
+}
+
+// Reset 清空记录
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = nil
+}
+
+func (r *Recorder) record(qc *QueryContext, q *Query) {
+	rq := RecordedQuery{
+		Type: qc.Type,
+		SQL:  q.SQL,
+		Args: append([]any(nil), q.Args...),
+	}
+	if qc.Model != nil {
+		rq.Table = qc.Model.TableName
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = append(r.queries, rq)
+}
+
+type dryRunKey struct{}
+
+// WithDryRun 这个 context 上的语句都只记录不执行，优先于 DBWithDryRun
+func WithDryRun(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, r)
+}
+
+// DBWithDryRun 整个 DB 都只记录不执行，一般用在测试里面
+// 注意开启事务之类不经过 Get、GetMulti 和 Exec 的操作还是会访问数据库
+func DBWithDryRun(r *Recorder) DBOption {
+	return func(db *DB) {
+		db.dryRun = r
+	}
+}
+
+func (c core) recorder(ctx context.Context) *Recorder {
+	if r, ok := ctx.Value(dryRunKey{}).(*Recorder); ok {
+		return r
+	}
+	return c.dryRun
+}
+
+// dryRunResult dry-run 模式下 Exec 的结果
+type dryRunResult struct{}
+
+func (dryRunResult) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (dryRunResult) RowsAffected() (int64, error) {
+	return 0, nil
+}
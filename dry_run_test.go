@@ -0,0 +1,116 @@
+package orm
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	var types []string
+	mdl := func(next Handler) Handler {
+		return func(ctx context.Context, qc *QueryContext) *QueryResult {
+			types = append(types, qc.Type)
+			q, err := qc.Query()
+			if err != nil {
+				return &QueryResult{Err: err}
+			}
+			q.SQL = "/* mdl */ " + q.SQL
+			return next(ctx, qc)
+		}
+	}
+	r := NewRecorder()
+	db, err := OpenDB(mockDB, DBWithDryRun(r), DBWithMiddleware(mdl))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = NewSelector[TestModel](db).Where(C("Id").Eq(1)).Get(ctx)
+	assert.Equal(t, ErrNoRows, err)
+
+	res, err := NewSelector[TestModel](db).Limit(10).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	affected, err := NewUpdater[TestModel](db).Set(Assign("Age", 18)).
+		Where(C("Id").Eq(1)).Exec(ctx).RowsAffected()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), affected)
+
+	val := &VersionModel{Id: 1, Name: "Tom", Version: 3}
+	err = NewUpdater[VersionModel](db).Update(val).Set(C("Name")).
+		Where(C("Id").Eq(1)).Exec(ctx).Err()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), val.Version)
+
+	raw, err := RawQuery[TestModel](db, "SELECT * FROM `test_model` WHERE `age` > ?", 18).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, raw)
+
+	assert.Equal(t, []string{"SELECT", "SELECT", "UPDATE", "UPDATE", "RAW"}, types)
+	assert.Equal(t, []RecordedQuery{
+		{
+			Type:  "SELECT",
+			Table: "test_model",
+			SQL:   "/* mdl */ SELECT * FROM `test_model` WHERE `id` = ?;",
+			Args:  []any{1},
+		},
+		{
+			Type:  "SELECT",
+			Table: "test_model",
+			SQL:   "/* mdl */ SELECT * FROM `test_model` LIMIT ?;",
+			Args:  []any{10},
+		},
+		{
+			Type:  "UPDATE",
+			Table: "test_model",
+			SQL:   "/* mdl */ UPDATE `test_model` SET `age`=? WHERE `id` = ?;",
+			Args:  []any{18, 1},
+		},
+		{
+			Type:  "UPDATE",
+			Table: "version_model",
+			SQL:   "/* mdl */ UPDATE `version_model` SET `name`=?,`version`=`version`+1 WHERE (`id` = ?) AND (`version` = ?);",
+			Args:  []any{"Tom", 1, int64(3)},
+		},
+		{
+			Type:  "RAW",
+			Table: "test_model",
+			SQL:   "/* mdl */ SELECT * FROM `test_model` WHERE `age` > ?",
+			Args:  []any{18},
+		},
+	}, r.Queries())
+
+	r.Reset()
+	assert.Empty(t, r.SQLs())
+	// 没有发给数据库
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithDryRun(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	r := NewRecorder()
+	_, err = NewSelector[TestModel](db).GetMulti(WithDryRun(context.Background(), r))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SELECT * FROM `test_model`;"}, r.SQLs())
+
+	// 别的 context 照常执行
+	mock.ExpectQuery("SELECT .*").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "first_name", "age", "last_name"}).
+			AddRow(1, "Tom", 18, "Jerry").AddRow(2, "Tom", 20, "Jerry"))
+	res, err := RawQuery[TestModel](db, "SELECT * FROM `test_model`").GetMulti(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.Len(t, r.SQLs(), 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
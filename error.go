@@ -2,4 +2,18 @@ package orm
 
 import "web/orm/internal/errs"
 
-var ErrNoRows = errs.ErrNoRows
+var (
+	ErrNoRows         = errs.ErrNoRows
+	ErrOptimisticLock = errs.ErrOptimisticLock
+	ErrShardingInTx   = errs.ErrShardingInTx
+	ErrQueryTimeout   = errs.ErrQueryTimeout
+)
+
+// NewErrUnknownField 和 NewErrUnknownColumn 主要是给 ormgen 生成的代码使用的
+func NewErrUnknownField(name string) error {
+	return errs.NewErrUnknownField(name)
+}
+
+func NewErrUnknownColumn(name string) error {
+	return errs.NewErrUnknownColumn(name)
+}
@@ -0,0 +1,67 @@
+package orm
+
+import "context"
+
+// 实体上的生命周期钩子，实体只要实现了对应的接口就会被调用
+// Before 钩子返回 error 会中断语句的执行
+// 钩子里面可以通过 SessionFromContext 拿到当前的 Session，在事务里面拿到的就是 *Tx
+
+// BeforeInsertHook 插入之前调用
+type BeforeInsertHook interface {
+	BeforeInsert(ctx context.Context) error
+}
+
+// AfterInsertHook 插入成功之后调用
+type AfterInsertHook interface {
+	AfterInsert(ctx context.Context) error
+}
+
+// BeforeUpdateHook 更新之前调用
+type BeforeUpdateHook interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+// AfterFindHook 查询出来之后调用，预加载的关联也会调用
+type AfterFindHook interface {
+	AfterFind(ctx context.Context) error
+}
+
+// BeforeDeleteHook 删除之前调用
+// 删除的时候没有实体，钩子是在 T 的零值上调用的，where 是 Deleter 上的条件
+type BeforeDeleteHook interface {
+	BeforeDelete(ctx context.Context, where []Predicate) error
+}
+
+type sessionKey struct{}
+
+// SessionFromContext 拿到执行语句的 Session，主要是给钩子使用的
+// 这样钩子里面的查询就能和语句本身在同一个事务里面
+func SessionFromContext(ctx context.Context) (Session, bool) {
+	sess, ok := ctx.Value(sessionKey{}).(Session)
+	return sess, ok
+}
+
+func withSession(ctx context.Context, sess Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, sess)
+}
+
+func beforeInsert(ctx context.Context, entity any) error {
+	if h, ok := entity.(BeforeInsertHook); ok {
+		return h.BeforeInsert(ctx)
+	}
+	return nil
+}
+
+func afterInsert(ctx context.Context, entity any) error {
+	if h, ok := entity.(AfterInsertHook); ok {
+		return h.AfterInsert(ctx)
+	}
+	return nil
+}
+
+func afterFind(ctx context.Context, entity any) error {
+	if h, ok := entity.(AfterFindHook); ok {
+		return h.AfterFind(ctx)
+	}
+	return nil
+}
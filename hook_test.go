@@ -0,0 +1,162 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+	"web/orm/internal/valuer"
+	"web/orm/model"
+)
+
+func TestHook(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	db := &DB{
+		db: mockDB,
+		core: core{
+			r:       model.NewRegistry(),
+			dialect: DialectMySOL,
+			creator: valuer.NewUnsafeValue,
+		},
+	}
+
+	t.Run("before insert abort", func(t *testing.T) {
+		ctx, rec := withHookRecorder(context.Background())
+		res := NewInserter[HookModel](db).Values(&HookModel{Id: 1, Name: "invalid"}).Exec(ctx)
+		assert.Equal(t, errors.New("invalid name"), res.Err())
+		assert.Empty(t, rec.calls)
+		// 没有发出任何语句
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("insert", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO `hook_model`.*").
+			WithArgs(int64(1), "Tom", "set by hook").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		ctx, rec := withHookRecorder(context.Background())
+		val := &HookModel{Id: 1, Name: "Tom"}
+		res := NewInserter[HookModel](db).Values(val).Exec(ctx)
+		require.NoError(t, res.Err())
+		assert.Equal(t, []string{"BeforeInsert", "AfterInsert"}, rec.calls[val.Id])
+		assert.Equal(t, db, rec.sess)
+	})
+
+	t.Run("after find", func(t *testing.T) {
+		mock.ExpectQuery("SELECT .*").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Tom"))
+		ctx, rec := withHookRecorder(context.Background())
+		_, err := NewSelector[HookModel](db).Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"AfterFind"}, rec.calls[1])
+
+		mock.ExpectQuery("SELECT .*").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Tom").AddRow(2, "Jerry"))
+		ctx, rec = withHookRecorder(context.Background())
+		_, err = NewSelector[HookModel](db).GetMulti(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, map[int64][]string{1: {"AfterFind"}, 2: {"AfterFind"}}, rec.calls)
+	})
+
+	t.Run("before update", func(t *testing.T) {
+		mock.ExpectExec("UPDATE `hook_model` SET .*").
+			WithArgs(int64(1), "Tom", "updated by hook", int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		ctx, rec := withHookRecorder(context.Background())
+		val := &HookModel{Id: 1, Name: "Tom"}
+		res := NewUpdater[HookModel](db).Update(val).Where(C("Id").Eq(int64(1))).Exec(ctx)
+		require.NoError(t, res.Err())
+		assert.Equal(t, []string{"BeforeUpdate"}, rec.calls[1])
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("before delete abort", func(t *testing.T) {
+		ctx, rec := withHookRecorder(context.Background())
+		res := NewDeleter[HookModel](db).Where(C("Id").Eq(int64(0))).Exec(ctx)
+		assert.Equal(t, errors.New("invalid id"), res.Err())
+		assert.Equal(t, []Predicate{C("Id").Eq(int64(0))}, rec.where)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("before delete", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM `hook_model` WHERE `id` = \\?;").
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		ctx, rec := withHookRecorder(context.Background())
+		res := NewDeleter[HookModel](db).Where(C("Id").Eq(int64(1))).Exec(ctx)
+		require.NoError(t, res.Err())
+		assert.Equal(t, []string{"BeforeDelete"}, rec.calls[0])
+		assert.Equal(t, []Predicate{C("Id").Eq(int64(1))}, rec.where)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+type HookModel struct {
+	Id     int64
+	Name   string
+	Remark string
+}
+
+// hookRecorder 记录钩子的调用情况，放在 context 里面，每个测试用自己的
+type hookRecorder struct {
+	// calls 的 key 是 Id
+	calls map[int64][]string
+	sess  Session
+	where []Predicate
+}
+
+type hookRecorderKey struct{}
+
+func withHookRecorder(ctx context.Context) (context.Context, *hookRecorder) {
+	rec := &hookRecorder{calls: map[int64][]string{}}
+	return context.WithValue(ctx, hookRecorderKey{}, rec), rec
+}
+
+func recordHook(ctx context.Context, id int64, name string) {
+	if rec, ok := ctx.Value(hookRecorderKey{}).(*hookRecorder); ok {
+		rec.calls[id] = append(rec.calls[id], name)
+		rec.sess, _ = SessionFromContext(ctx)
+	}
+}
+
+func (h *HookModel) BeforeInsert(ctx context.Context) error {
+	if h.Name == "invalid" {
+		return errors.New("invalid name")
+	}
+	h.Remark = "set by hook"
+	recordHook(ctx, h.Id, "BeforeInsert")
+	return nil
+}
+
+func (h *HookModel) AfterInsert(ctx context.Context) error {
+	recordHook(ctx, h.Id, "AfterInsert")
+	return nil
+}
+
+func (h *HookModel) AfterFind(ctx context.Context) error {
+	recordHook(ctx, h.Id, "AfterFind")
+	return nil
+}
+
+func (h *HookModel) BeforeUpdate(ctx context.Context) error {
+	h.Remark = "updated by hook"
+	recordHook(ctx, h.Id, "BeforeUpdate")
+	return nil
+}
+
+func (h *HookModel) BeforeDelete(ctx context.Context, where []Predicate) error {
+	if rec, ok := ctx.Value(hookRecorderKey{}).(*hookRecorder); ok {
+		rec.where = where
+	}
+	// 不允许删除 Id 为 0 的数据
+	if len(where) == 1 && reflect.DeepEqual(where[0], C("Id").Eq(int64(0))) {
+		return errors.New("invalid id")
+	}
+	recordHook(ctx, h.Id, "BeforeDelete")
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"strings"
+	"time"
 	"web/orm/internal/errs"
 	"web/orm/model"
 )
@@ -18,6 +19,23 @@ type Upsert struct {
 	conflictColumns []string
 }
 
+// assigned 是否已经更新了某个字段
+func (u *Upsert) assigned(name string) bool {
+	for _, assign := range u.assigns {
+		switch a := assign.(type) {
+		case Assignment:
+			if a.col == name {
+				return true
+			}
+		case Column:
+			if a.name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ConflictColumns 这是一个中间方法，冲突列名
 func (o *UpsertBuilder[T]) ConflictColumns(cols ...string) *UpsertBuilder[T] {
 	o.conflictColumns = cols
@@ -56,6 +74,8 @@ type Inserter[T any] struct {
 	builder
 	sess           Session
 	onDuplicateKey *Upsert
+	// at 第一次 Build 的时候确定的创建和更新时间，多次构造语句的时候不会重复修改实体
+	at time.Time
 }
 
 func NewInserter[T any](sess Session) *Inserter[T] {
@@ -79,6 +99,7 @@ func (i *Inserter[T]) OnDuplicateKey() *UpsertBuilder[T] {
 // Values 指定传入的参数并记录下来
 func (i *Inserter[T]) Values(vals ...*T) *Inserter[T] {
 	i.values = vals
+	i.at = time.Time{}
 	return i
 }
 
@@ -89,6 +110,7 @@ func (i *Inserter[T]) Columns(col ...string) *Inserter[T] {
 }
 
 func (i *Inserter[T]) Build() (*Query, error) {
+	i.reset()
 	n := len(i.values)
 	if n == 0 {
 		return nil, errs.ErrInsertZeroRow
@@ -138,10 +160,21 @@ func (i *Inserter[T]) Build() (*Query, error) {
 	i.sb.WriteString(" VALUES ")
 	args := make([]any, 0, n*len(i.model.Fields))
 
+	stamp := i.at.IsZero()
+	if stamp {
+		i.at = i.now()
+	}
+	now := i.at
 	for j, v := range i.values {
 		if j > 0 {
 			i.sb.WriteByte(',')
 		}
+		if fd := i.model.AutoCreateTime; fd != nil && stamp {
+			setAutoTime(v, fd, now, true)
+		}
+		if fd := i.model.AutoUpdateTime; fd != nil && stamp {
+			setAutoTime(v, fd, now, false)
+		}
 		i.sb.WriteByte('(')
 		val := i.creator(i.model, v)
 		// TODO 支持多列插入 大概要把下面提取成一个函数，然后遍历i.values，然后把sb内置成i的字段
@@ -162,7 +195,15 @@ func (i *Inserter[T]) Build() (*Query, error) {
 	}
 
 	if i.onDuplicateKey != nil {
-		err := i.dialect.buildOnDuplicateKey(&i.builder, i.onDuplicateKey)
+		odk := i.onDuplicateKey
+		// 冲突更新的时候也要维护更新时间
+		if fd := i.model.AutoUpdateTime; fd != nil && !odk.assigned(fd.GoName) {
+			odk = &Upsert{
+				assigns:         append(odk.assigns[:len(odk.assigns):len(odk.assigns)], Assign(fd.GoName, autoTimeValue(fd, now))),
+				conflictColumns: odk.conflictColumns,
+			}
+		}
+		err := i.dialect.buildOnDuplicateKey(&i.builder, odk)
 		if err != nil {
 			return nil, err
 		}
@@ -185,18 +226,35 @@ func (i *Inserter[T]) Exec(ctx context.Context) Result {
 			err: err,
 		}
 	}
-	res := exec(ctx, i.sess, i.core, &QueryContext{
-		Type:    "INSERT",
-		Builder: i,
-		Model:   i.model,
-	})
+	ctx = withSession(ctx, i.sess)
+	for _, v := range i.values {
+		if err = beforeInsert(ctx, v); err != nil {
+			return Result{
+				err: err,
+			}
+		}
+	}
+	var res *QueryResult
+	if algo, ok := shardingAlgo[T](i.core); ok {
+		res = i.shardingExec(ctx, algo)
+	} else {
+		res = exec(ctx, i.sess, i.core, &QueryContext{
+			Type:    "INSERT",
+			Builder: i,
+			Model:   i.model,
+		})
+	}
 
 	var sqlRes sql.Result
 	if res.Result != nil {
 		sqlRes = res.Result.(sql.Result)
 	}
+	err = res.Err
+	for j := 0; err == nil && j < len(i.values); j++ {
+		err = afterInsert(ctx, i.values[j])
+	}
 	return Result{
-		err: res.Err,
+		err: err,
 		res: sqlRes,
 	}
 }
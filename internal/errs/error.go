@@ -6,10 +6,20 @@ import (
 )
 
 var (
-	ErrPointerOnly   = errors.New("orm：只支持指向结构体的一级指针")
-	ErrDeleteALL     = errors.New("orm：不允许直接删除整张表")
-	ErrInsertZeroRow = errors.New("orm：插入0行")
-	ErrNoRows        = errors.New("orm: 没有数据")
+	ErrPointerOnly     = errors.New("orm：只支持指向结构体的一级指针")
+	ErrDeleteALL       = errors.New("orm：不允许直接删除整张表")
+	ErrUpdateALL       = errors.New("orm：不允许直接更新整张表")
+	ErrInsertZeroRow   = errors.New("orm：插入0行")
+	ErrNoRows          = errors.New("orm: 没有数据")
+	ErrUpdateNoColumns = errors.New("orm：没有指定要更新的列")
+	ErrUpdateNoEntity  = errors.New("orm：使用 C 更新需要先调用 Update 指定实体")
+	// ErrOptimisticLock 带版本号的更新没有影响任何行，说明数据已经被别人修改过了
+	ErrOptimisticLock = errors.New("orm: 乐观锁冲突，数据已经被修改")
+	// ErrShardingInTx 事务只能在一个库上，没法按照分片路由
+	ErrShardingInTx = errors.New("orm：分库分表的模型不能在事务里面使用")
+	// ErrQueryTimeout 语句执行超时，包括 context 超时和数据库限制的执行时间到了，
+	// 调用方主动取消的时候返回的还是 context.Canceled
+	ErrQueryTimeout = errors.New("orm：语句执行超时")
 )
 
 func NewErrUnsupportedExpression(expr any) error {
@@ -39,3 +49,56 @@ func NewErrUnsupportedAssignable(assign any) error {
 func NewErrFailedToRollbackTx(bizErr error, rbErr error, panicked bool) error {
 	return fmt.Errorf("orm: 事务闭包回滚失败，业务错误：%w, 回滚错误：%w，是否panic：%v", bizErr, rbErr, panicked)
 }
+
+func NewErrTxRetryExhausted(attempts int, err error) error {
+	return fmt.Errorf("orm：事务执行了 %d 次仍然失败：%w", attempts, err)
+}
+
+func NewErrUnknownRelation(name string) error {
+	return fmt.Errorf("orm：未知的关联关系 %s", name)
+}
+
+func NewErrInvalidRelation(field string, reason string) error {
+	return fmt.Errorf("orm：字段 %s 上的关联关系不合法，%s", field, reason)
+}
+
+func NewErrInvalidSoftDelete(field string, typ any) error {
+	return fmt.Errorf("orm：软删除字段 %s 不支持类型 %v", field, typ)
+}
+
+func NewErrInvalidVersion(field string, typ any) error {
+	return fmt.Errorf("orm：版本号字段 %s 不支持类型 %v", field, typ)
+}
+
+func NewErrInvalidAutoTime(field string, typ any) error {
+	return fmt.Errorf("orm：自动时间字段 %s 不支持类型 %v", field, typ)
+}
+
+func NewErrShardingUnsupported(reason string) error {
+	return fmt.Errorf("orm：分库分表不支持%s", reason)
+}
+
+func NewErrUnknownShardDB(name string) error {
+	return fmt.Errorf("orm：未知的分库 %s", name)
+}
+
+func NewErrInvalidShardingKey(key string, val any) error {
+	return fmt.Errorf("orm：分片键 %s 的值 %v 不合法", key, val)
+}
+
+// NewErrQueryTimeout 保留原本的错误，errors.Is 仍然可以判断 context.DeadlineExceeded
+func NewErrQueryTimeout(err error) error {
+	return fmt.Errorf("%w：%w", ErrQueryTimeout, err)
+}
+
+func NewErrInterpolateArgs(args int) error {
+	return fmt.Errorf("orm：占位符的数量和参数的数量 %d 不一致", args)
+}
+
+func NewErrUnsupportedInterpolateArg(arg any) error {
+	return fmt.Errorf("orm：不支持拼接到 SQL 里面的参数类型 %T", arg)
+}
+
+func NewErrInvalidSavepoint(name string) error {
+	return fmt.Errorf("orm：保存点的名字 %q 不是合法的标识符", name)
+}
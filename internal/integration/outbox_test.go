@@ -0,0 +1,96 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"path/filepath"
+	"testing"
+	"web/orm"
+)
+
+type OutboxSuite struct {
+	Suite
+}
+
+func TestSQLiteOutbox(t *testing.T) {
+	suite.Run(t, &OutboxSuite{
+		Suite: Suite{
+			driver: "sqlite3",
+			dsn:    "file:" + filepath.Join(t.TempDir(), "outbox.db"),
+			opts:   []orm.DBOption{orm.DBWithDialect(orm.DialectSQLite)},
+		},
+	})
+}
+
+func (s *OutboxSuite) SetupSuite() {
+	s.Suite.SetupSuite()
+	for _, ddl := range []string{
+		"CREATE TABLE `orm_outbox` (`id` INTEGER PRIMARY KEY AUTOINCREMENT, `topic` TEXT NOT NULL, " +
+			"`payload` BLOB, `sent` BOOLEAN NOT NULL DEFAULT 0, `ctime` INTEGER NOT NULL)",
+		"CREATE TABLE `tx_user` (`id` INTEGER PRIMARY KEY, `name` TEXT NOT NULL)",
+	} {
+		res := orm.RawQuery[TxUser](s.db, ddl).Exec(context.Background())
+		require.NoError(s.T(), res.Err())
+	}
+}
+
+func (s *OutboxSuite) TestRelay() {
+	t := s.T()
+	ctx := context.Background()
+	mockErr := errors.New("mock error")
+
+	// 业务失败的时候消息也不会写进去
+	err := s.db.DoTx(ctx, func(ctx context.Context, tx *orm.Tx) error {
+		if err := orm.PublishOutbox(ctx, tx, "user", []byte("rollback")); err != nil {
+			return err
+		}
+		return mockErr
+	}, nil)
+	require.ErrorIs(t, err, mockErr)
+
+	var published []string
+	for _, name := range []string{"Tom", "Jerry", "Spike"} {
+		err = s.db.DoTx(ctx, func(ctx context.Context, tx *orm.Tx) error {
+			res := orm.NewInserter[TxUser](tx).Columns("Name").Values(&TxUser{Name: name}).Exec(ctx)
+			if res.Err() != nil {
+				return res.Err()
+			}
+			tx.AfterCommit(func(ctx context.Context) {
+				published = append(published, name)
+			})
+			return orm.PublishOutbox(ctx, tx, "user", []byte(name))
+		}, nil)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"Tom", "Jerry", "Spike"}, published)
+
+	var got []string
+	fail := true
+	relay := orm.NewOutboxRelay(s.db, func(ctx context.Context, msgs []*orm.OutboxMessage) error {
+		// 第一次投递失败，消息会留在发件箱里面
+		if fail {
+			fail = false
+			return mockErr
+		}
+		for _, msg := range msgs {
+			got = append(got, string(msg.Payload))
+		}
+		return nil
+	}, orm.OutboxRelayWithBatchSize(2))
+
+	_, err = relay.RelayOnce(ctx)
+	assert.ErrorIs(t, err, mockErr)
+	cnt, err := relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, cnt)
+	cnt, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cnt)
+	cnt, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cnt)
+	assert.Equal(t, []string{"Tom", "Jerry", "Spike"}, got)
+}
@@ -11,11 +11,12 @@ type Suite struct {
 	db     *orm.DB
 	driver string
 	dsn    string
+	opts   []orm.DBOption
 }
 
 // SetupSuite 在suite执行之前要执行的代码
 func (i *Suite) SetupSuite() {
-	db, err := orm.Open(i.driver, i.dsn)
+	db, err := orm.Open(i.driver, i.dsn, i.opts...)
 	require.NoError(i.T(), err)
 	db.Wait()
 	i.db = db
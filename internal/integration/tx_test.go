@@ -0,0 +1,161 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"path/filepath"
+	"testing"
+	"web/orm"
+)
+
+// TxSuite 事务的集成测试，SQLite 不需要额外启动数据库，所以不需要 e2e 标签
+type TxSuite struct {
+	Suite
+}
+
+type TxUser struct {
+	Id   int64
+	Name string
+}
+
+func TestSQLiteTx(t *testing.T) {
+	suite.Run(t, &TxSuite{
+		Suite: Suite{
+			driver: "sqlite3",
+			dsn:    "file:" + filepath.Join(t.TempDir(), "tx.db"),
+			opts:   []orm.DBOption{orm.DBWithDialect(orm.DialectSQLite)},
+		},
+	})
+}
+
+func (s *TxSuite) SetupSuite() {
+	s.Suite.SetupSuite()
+	res := orm.RawQuery[TxUser](s.db,
+		"CREATE TABLE `tx_user` (`id` INTEGER PRIMARY KEY, `name` TEXT NOT NULL)").
+		Exec(context.Background())
+	require.NoError(s.T(), res.Err())
+}
+
+func (s *TxSuite) TearDownTest() {
+	res := orm.RawQuery[TxUser](s.db, "DELETE FROM `tx_user`").Exec(context.Background())
+	require.NoError(s.T(), res.Err())
+}
+
+// ids 事务外面能看到的数据
+func (s *TxSuite) ids() []int64 {
+	users, err := orm.NewSelector[TxUser](s.db).GetMulti(context.Background())
+	require.NoError(s.T(), err)
+	res := make([]int64, 0, len(users))
+	for _, u := range users {
+		res = append(res, u.Id)
+	}
+	return res
+}
+
+func (s *TxSuite) TestDoTx() {
+	mockErr := errors.New("mock error")
+	testCases := []struct {
+		name         string
+		fn           func(ctx context.Context, tx *orm.Tx) error
+		wantErr      error
+		wantIds      []int64
+		wantCommit   bool
+		wantRollback bool
+	}{
+		{
+			name: "commit",
+			fn: func(ctx context.Context, tx *orm.Tx) error {
+				res := orm.NewInserter[TxUser](tx).Values(&TxUser{Id: 1, Name: "Tom"}).Exec(ctx)
+				if res.Err() != nil {
+					return res.Err()
+				}
+				// 事务里面能读到自己写的数据
+				u, err := orm.NewSelector[TxUser](tx).Where(orm.C("Id").Eq(1)).Get(ctx)
+				if err != nil {
+					return err
+				}
+				assert.Equal(s.T(), "Tom", u.Name)
+				return nil
+			},
+			wantIds:    []int64{1},
+			wantCommit: true,
+		},
+		{
+			name: "rollback",
+			fn: func(ctx context.Context, tx *orm.Tx) error {
+				res := orm.NewInserter[TxUser](tx).Values(&TxUser{Id: 1, Name: "Tom"}).Exec(ctx)
+				if res.Err() != nil {
+					return res.Err()
+				}
+				return mockErr
+			},
+			wantErr:      mockErr,
+			wantIds:      []int64{},
+			wantRollback: true,
+		},
+		{
+			// 只拿到了 DB 的代码通过 context 加入事务
+			name: "context tx",
+			fn: func(ctx context.Context, tx *orm.Tx) error {
+				res := orm.NewInserter[TxUser](s.db).Values(&TxUser{Id: 1, Name: "Tom"}).Exec(ctx)
+				if res.Err() != nil {
+					return res.Err()
+				}
+				return mockErr
+			},
+			wantErr:      mockErr,
+			wantIds:      []int64{},
+			wantRollback: true,
+		},
+		{
+			name: "savepoint",
+			fn: func(ctx context.Context, tx *orm.Tx) error {
+				res := orm.NewInserter[TxUser](tx).Values(&TxUser{Id: 1, Name: "Tom"}).Exec(ctx)
+				if res.Err() != nil {
+					return res.Err()
+				}
+				err := tx.DoTx(ctx, func(ctx context.Context, tx *orm.Tx) error {
+					res := orm.NewInserter[TxUser](tx).Values(&TxUser{Id: 2, Name: "Jerry"}).Exec(ctx)
+					if res.Err() != nil {
+						return res.Err()
+					}
+					return mockErr
+				})
+				if !errors.Is(err, mockErr) {
+					return err
+				}
+				return nil
+			},
+			wantIds:    []int64{1},
+			wantCommit: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		s.T().Run(tc.name, func(t *testing.T) {
+			defer s.TearDownTest()
+			var committed, rolledBack bool
+			err := s.db.DoTx(context.Background(), func(ctx context.Context, tx *orm.Tx) error {
+				tx.OnCommit(func() {
+					committed = true
+				})
+				tx.OnRollback(func() {
+					rolledBack = true
+				})
+				return tc.fn(ctx, tx)
+			}, nil)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantIds, s.ids())
+			assert.Equal(t, tc.wantCommit, committed)
+			assert.Equal(t, tc.wantRollback, rolledBack)
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Package sqlparse 简单的 SQL 词法分析，给中间件找关键字和表名用的
+package sqlparse
+
+import (
+	"strings"
+)
+
+// token SQL 里面的一个词，引号里面的内容会被当作一个标识符或者字符串
+type token struct {
+	text string
+	// quoted 用反引号或者双引号包裹的标识符
+	quoted bool
+	// literal 字符串字面量
+	literal bool
+	// depth 所在的括号层数，子查询里面的词 depth 大于 0
+	depth int
+}
+
+// tokenize 简单的词法分析，只是为了找到关键字和表名，不是完整的 SQL 解析
+// 会跳过注释和字符串，关键字统一转换成大写
+func tokenize(sql string) []token {
+	var res []token
+	depth := 0
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return res
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < len(sql) && sql[j] != c {
+				if sql[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			text := sql[i+1 : min(j, len(sql))]
+			res = append(res, token{text: text, quoted: c != '\'', literal: c == '\'', depth: depth})
+			i = j + 1
+		case c == '(':
+			res = append(res, token{text: "(", depth: depth})
+			depth++
+			i++
+		case c == ')':
+			depth--
+			res = append(res, token{text: ")", depth: depth})
+			i++
+		case isWordByte(c):
+			j := i
+			for j < len(sql) && isWordByte(sql[j]) {
+				j++
+			}
+			res = append(res, token{text: strings.ToUpper(sql[i:j]), depth: depth})
+			i = j
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		default:
+			res = append(res, token{text: string(c), depth: depth})
+			i++
+		}
+	}
+	return res
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// Statement 解析之后的语句
+type Statement struct {
+	// Verb 第一个关键字，例如 SELECT
+	Verb   string
+	tokens []token
+}
+
+func Parse(sql string) Statement {
+	tokens := tokenize(sql)
+	var verb string
+	for _, t := range tokens {
+		if !t.quoted && !t.literal && t.text != "(" {
+			verb = t.text
+			break
+		}
+	}
+	return Statement{Verb: verb, tokens: tokens}
+}
+
+// HasKeyword 最外层是否有这个关键字，子查询里面的不算
+func (s Statement) HasKeyword(kw string) bool {
+	for _, t := range s.tokens {
+		if t.depth == 0 && !t.quoted && !t.literal && t.text == kw {
+			return true
+		}
+	}
+	return false
+}
+
+// Tables 最外层 FROM、JOIN、UPDATE、INTO 后面的表名，库名会被去掉，
+// FROM 和 UPDATE 后面用逗号分隔的多个表都算
+// ORM 构造的 JOIN 会用括号包起来，例如 FROM (`a` JOIN `b` ON ...)，
+// 这种括号里面的表也算最外层，子查询里面的不算
+func (s Statement) Tables() []string {
+	return s.tables(false)
+}
+
+// AllTables 和 Tables 一样，但是包括子查询里面的表
+func (s Statement) AllTables() []string {
+	return s.tables(true)
+}
+
+func (s Statement) tables(subquery bool) []string {
+	var res []string
+	// subqueries 每一层括号是不是子查询
+	var subqueries []bool
+	inSubquery := false
+	for i := 0; i < len(s.tokens)-1; i++ {
+		t := s.tokens[i]
+		if t.quoted || t.literal {
+			continue
+		}
+		switch t.text {
+		case "(":
+			subqueries = append(subqueries, inSubquery || s.tokens[i+1].isKeyword("SELECT", "WITH"))
+			inSubquery = subqueries[len(subqueries)-1]
+			continue
+		case ")":
+			if len(subqueries) > 0 {
+				subqueries = subqueries[:len(subqueries)-1]
+			}
+			inSubquery = len(subqueries) > 0 && subqueries[len(subqueries)-1]
+			continue
+		case "FROM", "JOIN", "UPDATE", "INTO":
+		default:
+			continue
+		}
+		if inSubquery && !subquery {
+			continue
+		}
+		name, j := s.tableAt(i + 1)
+		if name == "" {
+			continue
+		}
+		res = append(res, name)
+		if !t.isKeyword("FROM", "UPDATE") {
+			continue
+		}
+		// FROM a, b AS c, d 这种逗号分隔的表
+		for {
+			k := j + 1
+			if k < len(s.tokens) && s.tokens[k].isKeyword("AS") {
+				k++
+			}
+			if k < len(s.tokens) && s.tokens[k].text != "," && s.tokens[k].depth == s.tokens[j].depth &&
+				(s.tokens[k].quoted || isWordByte(s.tokens[k].text[0])) {
+				k++
+			}
+			if k >= len(s.tokens) || !s.tokens[k].isKeyword(",") || s.tokens[k].depth != s.tokens[j].depth {
+				break
+			}
+			if name, j = s.tableAt(k + 1); name == "" {
+				break
+			}
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// tableAt 从 i 开始读一个表名，返回小写的表名和表名所在的位置
+// 跳过联表的括号，括号留给外面处理；子查询、字符串这些不是表名的时候返回空字符串
+func (s Statement) tableAt(i int) (string, int) {
+	j := i
+	for j < len(s.tokens)-1 && s.tokens[j].isKeyword("(") {
+		j++
+	}
+	if j >= len(s.tokens) {
+		return "", j
+	}
+	name := s.tokens[j]
+	if name.literal || name.isKeyword("SELECT", "WITH") || !name.quoted && !isWordByte(name.text[0]) {
+		return "", j
+	}
+	// db.table
+	for j+2 < len(s.tokens) && s.tokens[j+1].isKeyword(".") {
+		j += 2
+		name = s.tokens[j]
+	}
+	return strings.ToLower(name.text), j
+}
+
+// isKeyword 没有被引号包裹，并且是 kws 里面的一个
+func (t token) isKeyword(kws ...string) bool {
+	if t.quoted || t.literal {
+		return false
+	}
+	for _, kw := range kws {
+		if t.text == kw {
+			return true
+		}
+	}
+	return false
+}
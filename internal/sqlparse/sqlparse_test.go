@@ -0,0 +1,82 @@
+package sqlparse
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStatement_Tables(t *testing.T) {
+	testCases := []struct {
+		name          string
+		sql           string
+		wantVerb      string
+		wantTables    []string
+		wantAllTables []string
+	}{
+		{
+			name:          "select",
+			sql:           "SELECT * FROM `user` WHERE `id` = ?;",
+			wantVerb:      "SELECT",
+			wantTables:    []string{"user"},
+			wantAllTables: []string{"user"},
+		},
+		{
+			name:          "join group",
+			sql:           "SELECT * FROM (`user` JOIN `shop`.`order` ON `user`.`id`=`order`.`uid`);",
+			wantVerb:      "SELECT",
+			wantTables:    []string{"user", "order"},
+			wantAllTables: []string{"user", "order"},
+		},
+		{
+			name:          "subquery",
+			sql:           "SELECT * FROM `user` WHERE `id` IN (SELECT `uid` FROM `order` WHERE `note` = 'from x');",
+			wantVerb:      "SELECT",
+			wantTables:    []string{"user"},
+			wantAllTables: []string{"user", "order"},
+		},
+		{
+			name:          "comma",
+			sql:           "SELECT * FROM `user` AS u, shop.`order` o, `role` WHERE u.`id` = o.`uid` LIMIT 1, 10;",
+			wantVerb:      "SELECT",
+			wantTables:    []string{"user", "order", "role"},
+			wantAllTables: []string{"user", "order", "role"},
+		},
+		{
+			// 子查询里面的逗号不是表
+			name:          "comma subquery",
+			sql:           "SELECT * FROM `user`, (SELECT `uid`, `id` FROM `order`) AS o WHERE `id` IN (1, 2);",
+			wantVerb:      "SELECT",
+			wantTables:    []string{"user"},
+			wantAllTables: []string{"user", "order"},
+		},
+		{
+			name:          "update multiple tables",
+			sql:           "UPDATE `user` u, `order` SET u.`name` = ?, `note` = ?;",
+			wantVerb:      "UPDATE",
+			wantTables:    []string{"user", "order"},
+			wantAllTables: []string{"user", "order"},
+		},
+		{
+			name:          "update",
+			sql:           "update user set name = ? /* FROM `order` */",
+			wantVerb:      "UPDATE",
+			wantTables:    []string{"user"},
+			wantAllTables: []string{"user"},
+		},
+		{
+			name:          "insert",
+			sql:           "INSERT INTO `order`(`id`) VALUES(?);",
+			wantVerb:      "INSERT",
+			wantTables:    []string{"order"},
+			wantAllTables: []string{"order"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt := Parse(tc.sql)
+			assert.Equal(t, tc.wantVerb, stmt.Verb)
+			assert.Equal(t, tc.wantTables, stmt.Tables())
+			assert.Equal(t, tc.wantAllTables, stmt.AllTables())
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package valuer
+
+import (
+	"database/sql"
+	"web/orm/internal/errs"
+	"web/orm/model"
+)
+
+// Generated ormgen 生成的方法，直接读字段和拿字段的地址，参数都是 Go 字段名。
+// ormgen 没有直接生成 SetColumn：结果集的列名要以注册的元数据为准，
+// 注册的时候用 WithColumnName 改了列名也不会和生成的代码对不上，
+// 所以生成的是 FieldAddr，扫描仍然在 valuer 里面按照 ColumnMap 完成
+type Generated interface {
+	Field(name string) (any, error)
+	FieldAddr(name string) (any, error)
+}
+
+// WithGenerated 按照下面的顺序选择 Value 的实现：
+//   - 实现了 Generated 的模型，使用 Field 和 FieldAddr 直接读写字段，
+//     没有 reflect.NewAt 和装箱的开销
+//   - 模型自己实现了 Value，也就是自己写了 Field 和 SetColumn，直接使用模型本身，
+//     这时候列名和字段的对应关系由模型自己负责
+//   - 都没有的时候，退化为 fallback
+func WithGenerated(fallback Creator) Creator {
+	return func(model *model.Model, entity any) Value {
+		if g, ok := entity.(Generated); ok {
+			return generatedValue{model: model, entity: g}
+		}
+		if val, ok := entity.(Value); ok {
+			return val
+		}
+		return fallback(model, entity)
+	}
+}
+
+type generatedValue struct {
+	model  *model.Model
+	entity Generated
+}
+
+func (g generatedValue) Field(name string) (any, error) {
+	return g.entity.Field(name)
+}
+
+// SetColumn 列名还是通过元数据找到字段，
+// 这样注册元数据的时候修改了列名，生成的代码也不会和元数据不一致
+func (g generatedValue) SetColumn(rows *sql.Rows) error {
+	cs, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	vals := make([]any, 0, len(cs))
+	for _, c := range cs {
+		fd, ok := g.model.ColumnMap[c]
+		if !ok {
+			return errs.NewErrUnknownColumn(c)
+		}
+		addr, err := g.entity.FieldAddr(fd.GoName)
+		if err != nil {
+			return err
+		}
+		vals = append(vals, addr)
+	}
+	return rows.Scan(vals...)
+}
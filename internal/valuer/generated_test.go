@@ -0,0 +1,143 @@
+package valuer
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"web/orm/internal/errs"
+	"web/orm/model"
+)
+
+func TestWithGenerated(t *testing.T) {
+	testCases := []struct {
+		name      string
+		entity    any
+		wantField any
+	}{
+		{
+			name:      "generated",
+			entity:    &generatedModel{Id: 12},
+			wantField: int64(12),
+		},
+		{
+			// 自己实现了 Value 的模型直接使用
+			name:      "value",
+			entity:    &valueModel{Id: 14},
+			wantField: "value",
+		},
+		{
+			name:      "fallback",
+			entity:    &TestModel{Id: 13},
+			wantField: int64(13),
+		},
+	}
+
+	r := model.NewRegistry()
+	creator := WithGenerated(NewUnsafeValue)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := r.Get(tc.entity)
+			assert.NoError(t, err)
+			val := creator(m, tc.entity)
+			fd, err := val.Field("Id")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantField, fd)
+		})
+	}
+}
+
+func TestGeneratedValue_SetColumn(t *testing.T) {
+	testCases := []struct {
+		name       string
+		cols       []string
+		wantErr    error
+		wantEntity *generatedModel
+	}{
+		{
+			// 注册的时候改过列名，以元数据为准
+			name:       "renamed column",
+			cols:       []string{"gid", "name"},
+			wantEntity: &generatedModel{Id: 1, Name: "Tom"},
+		},
+		{
+			name:    "unknown column",
+			cols:    []string{"id"},
+			wantErr: errs.NewErrUnknownColumn("id"),
+		},
+	}
+
+	r := model.NewRegistry()
+	m, err := r.Register(&generatedModel{}, model.WithColumnName("Id", "gid"))
+	require.NoError(t, err)
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	creator := WithGenerated(NewUnsafeValue)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			row := sqlmock.NewRows(tc.cols)
+			if len(tc.cols) == 2 {
+				row.AddRow(1, "Tom")
+			} else {
+				row.AddRow(1)
+			}
+			mock.ExpectQuery("SELECT XX").WillReturnRows(row)
+			rows, err := mockDB.Query("SELECT XX")
+			require.NoError(t, err)
+			defer rows.Close()
+			require.True(t, rows.Next())
+
+			entity := &generatedModel{}
+			err = creator(m, entity).SetColumn(rows)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantEntity, entity)
+		})
+	}
+}
+
+// valueModel 自己实现了 Value
+type valueModel struct {
+	Id int64
+}
+
+func (v *valueModel) Field(name string) (any, error) {
+	return "value", nil
+}
+
+func (v *valueModel) SetColumn(rows *sql.Rows) error {
+	return rows.Scan(&v.Id)
+}
+
+// generatedModel 模拟 ormgen 生成的代码
+type generatedModel struct {
+	Id   int64
+	Name string
+}
+
+func (g *generatedModel) Field(name string) (any, error) {
+	switch name {
+	case "Id":
+		return g.Id, nil
+	case "Name":
+		return g.Name, nil
+	default:
+		return nil, errs.NewErrUnknownField(name)
+	}
+}
+
+func (g *generatedModel) FieldAddr(name string) (any, error) {
+	switch name {
+	case "Id":
+		return &g.Id, nil
+	case "Name":
+		return &g.Name, nil
+	default:
+		return nil, errs.NewErrUnknownField(name)
+	}
+}
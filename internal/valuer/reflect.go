@@ -58,15 +58,10 @@ func (r reflectValue) SetColumn(rows *sql.Rows) error {
 		return err
 	}
 
-	tpValue := reflect.ValueOf(r.val)
 	for k, c := range cs {
-		fd, ok := r.model.ColumnMap[c]
-		if !ok {
-			return nil
-		}
-		// 类似一个赋值操作
-		tpValue.Elem().FieldByName(fd.GoName).
-			Set(valElems[k])
+		fd := r.model.ColumnMap[c]
+		// 类似一个赋值操作，r.val 已经是 T 本身了
+		r.val.FieldByName(fd.GoName).Set(valElems[k])
 	}
 	return nil
 }
@@ -0,0 +1,150 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"web/orm/internal/errs"
+)
+
+// Interpolate 把参数直接拼接到 SQL 里面，得到一条可以复制出来执行的语句，只用于调试和日志。
+// 千万不要用它来执行语句，参数化查询才是防止 SQL 注入的手段。
+// 从中间件里面拿到的 Query 会使用 DB 的方言转义，直接 Build 出来的使用 MySQL 的规则
+func (q *Query) Interpolate() (string, error) {
+	dialect := q.dialect
+	if dialect == nil {
+		dialect = DialectMySOL
+	}
+	var sb strings.Builder
+	argIdx := 0
+	sql := q.SQL
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// 引号里面的 ? 不是占位符，原样输出
+			j := i + 1
+			for j < len(sql) && sql[j] != c {
+				if sql[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j, len(sql)-1)
+			sb.WriteString(sql[i : j+1])
+			i = j
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			sb.WriteString(sql[i : i+end])
+			i += end - 1
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				sb.WriteString(sql[i:])
+				i = len(sql)
+				continue
+			}
+			sb.WriteString(sql[i : i+end+4])
+			i += end + 3
+		case c == '?':
+			if argIdx >= len(q.Args) {
+				return "", errs.NewErrInterpolateArgs(len(q.Args))
+			}
+			lit, err := literal(dialect, q.Args[argIdx])
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(lit)
+			argIdx++
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	if argIdx != len(q.Args) {
+		return "", errs.NewErrInterpolateArgs(len(q.Args))
+	}
+	return sb.String(), nil
+}
+
+// String 拼接了参数的 SQL，拼接失败的时候输出 SQL 和参数
+func (q *Query) String() string {
+	res, err := q.Interpolate()
+	if err != nil {
+		return fmt.Sprintf("%s %v", q.SQL, q.Args)
+	}
+	return res
+}
+
+// literal 把参数转换成 SQL 字面量
+func literal(dialect Dialect, arg any) (string, error) {
+	if arg == nil {
+		return "NULL", nil
+	}
+	rv := reflect.ValueOf(arg)
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return "NULL", nil
+	}
+	if valuer, ok := arg.(driver.Valuer); ok {
+		val, err := valuer.Value()
+		if err != nil {
+			return "", err
+		}
+		return literal(dialect, val)
+	}
+	switch val := arg.(type) {
+	case string:
+		return dialect.stringLiteral(val), nil
+	case []byte:
+		// 文本直接按照字符串输出，例如 JSON，其它的用十六进制
+		if isText(val) {
+			return dialect.stringLiteral(string(val)), nil
+		}
+		return "X'" + hex.EncodeToString(val) + "'", nil
+	case time.Time:
+		// 和 MySQL 驱动默认的 loc=UTC 保持一致，不然同一个时间在不同时区的机器上输出不一样
+		return dialect.stringLiteral(val.UTC().Format("2006-01-02 15:04:05.999999")), nil
+	case bool:
+		if val {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	}
+	switch rv.Kind() {
+	case reflect.Pointer:
+		return literal(dialect, rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32:
+		// 按照 64 位输出的话 float32(3.2) 会变成 3.200000047683716
+		return strconv.FormatFloat(rv.Float(), 'g', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, 64), nil
+	case reflect.String:
+		return dialect.stringLiteral(rv.String()), nil
+	case reflect.Bool:
+		return literal(dialect, rv.Bool())
+	}
+	return "", errs.NewErrUnsupportedInterpolateArg(arg)
+}
+
+func isText(bs []byte) bool {
+	if !utf8.Valid(bs) {
+		return false
+	}
+	for _, b := range bs {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' {
+			return false
+		}
+	}
+	return true
+}
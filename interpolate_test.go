@@ -0,0 +1,164 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"web/orm/internal/errs"
+	"web/orm/test"
+)
+
+func TestQuery_Interpolate(t *testing.T) {
+	type Status string
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	name := "Tom"
+	var nilPtr *string
+	testCases := []struct {
+		name    string
+		q       *Query
+		want    string
+		wantErr error
+	}{
+		{
+			name: "basic",
+			q: &Query{
+				SQL:  "SELECT * FROM `user` WHERE `id` = ? AND `age` > ? AND `score` < ? AND `ok` = ?;",
+				Args: []any{int64(1), uint8(18), 1.5, true},
+			},
+			want: "SELECT * FROM `user` WHERE `id` = 1 AND `age` > 18 AND `score` < 1.5 AND `ok` = TRUE;",
+		},
+		{
+			name: "string",
+			q: &Query{
+				SQL:  "UPDATE `user` SET `name`=?,`status`=? WHERE `id` = ?;",
+				Args: []any{`it's a \ path`, Status("active"), &name},
+			},
+			want: "UPDATE `user` SET `name`='it''s a \\\\ path',`status`='active' WHERE `id` = 'Tom';",
+		},
+		{
+			name: "sqlite string",
+			q: &Query{
+				SQL:     "UPDATE `user` SET `name`=?;",
+				Args:    []any{`it's a \ path`},
+				dialect: DialectSQLite,
+			},
+			want: "UPDATE `user` SET `name`='it''s a \\ path';",
+		},
+		{
+			name: "null",
+			q: &Query{
+				SQL:  "INSERT INTO `user` VALUES(?,?,?,?);",
+				Args: []any{nil, nilPtr, sql.NullString{}, (*test.JsonColumn)(nil)},
+			},
+			want: "INSERT INTO `user` VALUES(NULL,NULL,NULL,NULL);",
+		},
+		{
+			name: "valuer",
+			q: &Query{
+				SQL: "INSERT INTO `user` VALUES(?,?,?);",
+				Args: []any{
+					sql.NullInt64{Int64: 12, Valid: true},
+					&test.JsonColumn{Val: test.User{Name: "Tom"}, Valid: true},
+					sql.NullTime{Time: ts, Valid: true},
+				},
+			},
+			want: "INSERT INTO `user` VALUES(12,'{\"Name\":\"Tom\"}','2024-01-02 03:04:05.000006');",
+		},
+		{
+			name: "float32",
+			q: &Query{
+				SQL:  "SELECT * FROM `user` WHERE `score` < ? AND `rate` > ?;",
+				Args: []any{float32(3.2), 3.2},
+			},
+			want: "SELECT * FROM `user` WHERE `score` < 3.2 AND `rate` > 3.2;",
+		},
+		{
+			name: "time in other location",
+			q: &Query{
+				SQL:  "SELECT * FROM `user` WHERE `ctime` > ?;",
+				Args: []any{ts.In(time.FixedZone("CST", 8*3600))},
+			},
+			want: "SELECT * FROM `user` WHERE `ctime` > '2024-01-02 03:04:05.000006';",
+		},
+		{
+			name: "bytes",
+			q: &Query{
+				SQL:  "INSERT INTO `file` VALUES(?,?);",
+				Args: []any{[]byte("hello"), []byte{0, 1, 0xff}},
+			},
+			want: "INSERT INTO `file` VALUES('hello',X'0001ff');",
+		},
+		{
+			name: "placeholder in quotes and comments",
+			q: &Query{
+				SQL:  "SELECT '?', `a?` /* ? */ FROM `user` WHERE `id` = ? -- ?",
+				Args: []any{1},
+			},
+			want: "SELECT '?', `a?` /* ? */ FROM `user` WHERE `id` = 1 -- ?",
+		},
+		{
+			name: "too few args",
+			q: &Query{
+				SQL:  "SELECT * FROM `user` WHERE `id` = ? AND `age` = ?;",
+				Args: []any{1},
+			},
+			wantErr: errs.NewErrInterpolateArgs(1),
+		},
+		{
+			name: "too many args",
+			q: &Query{
+				SQL:  "SELECT * FROM `user`;",
+				Args: []any{1},
+			},
+			wantErr: errs.NewErrInterpolateArgs(1),
+		},
+		{
+			name: "unsupported",
+			q: &Query{
+				SQL:  "SELECT * FROM `user` WHERE `id` IN (?);",
+				Args: []any{[]int{1, 2}},
+			},
+			wantErr: errs.NewErrUnsupportedInterpolateArg([]int{1, 2}),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := tc.q.Interpolate()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				// String 拼接失败的时候输出原本的 SQL 和参数
+				assert.Contains(t, tc.q.String(), tc.q.SQL)
+				return
+			}
+			assert.Equal(t, tc.want, res)
+			assert.Equal(t, tc.want, tc.q.String())
+		})
+	}
+}
+
+func TestQueryContext_QueryDialect(t *testing.T) {
+	mockDB, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	var stmt string
+	mdl := func(next Handler) Handler {
+		return func(ctx context.Context, qc *QueryContext) *QueryResult {
+			q, err := qc.Query()
+			require.NoError(t, err)
+			stmt = q.String()
+			return next(ctx, qc)
+		}
+	}
+	db, err := OpenDB(mockDB, DBWithDialect(DialectSQLite), DBWithMiddleware(mdl),
+		DBWithDryRun(NewRecorder()))
+	require.NoError(t, err)
+
+	_, err = NewSelector[TestModel](db).Where(C("FirstName").Eq(`\`)).GetMulti(context.Background())
+	require.NoError(t, err)
+	// 中间件拿到的 Query 使用 DB 的方言转义
+	assert.Equal(t, "SELECT * FROM `test_model` WHERE `first_name` = '\\';", stmt)
+}
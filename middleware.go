@@ -2,6 +2,8 @@ package orm
 
 import (
 	"context"
+	"strings"
+	"time"
 	"web/orm/model"
 )
 
@@ -13,6 +15,41 @@ type QueryContext struct {
 	Builder QueryBuilder
 
 	Model *model.Model
+	// Multi 为 true 表示是 GetMulti，结果是 []*T，否则是 *T
+	Multi bool
+
+	// q 构造好的查询，整条链路共用一份
+	q   *Query
+	err error
+	// dialect 执行语句的 DB 的方言
+	dialect Dialect
+}
+
+// Query 拿到构造好的查询
+// 只会构造一次，所以中间件可以直接修改返回的 Query，最终执行的就是修改之后的语句
+func (qc *QueryContext) Query() (*Query, error) {
+	if qc.q == nil && qc.err == nil {
+		qc.q, qc.err = qc.Builder.Build()
+		if qc.q != nil {
+			qc.q.dialect = qc.dialect
+		}
+	}
+	return qc.q, qc.err
+}
+
+// AddExecutionTimeHint 给 SELECT 加上数据库那边限制执行时间的提示，例如 MySQL 的 MAX_EXECUTION_TIME，
+// 方言不支持或者语句已经带了提示的时候什么也不做
+func (qc *QueryContext) AddExecutionTimeHint(d time.Duration) error {
+	q, err := qc.Query()
+	if err != nil || qc.dialect == nil {
+		return err
+	}
+	hint := qc.dialect.executionTimeHint(d)
+	if hint == "" || !strings.HasPrefix(q.SQL, "SELECT ") || strings.Contains(q.SQL, "/*+") {
+		return nil
+	}
+	q.SQL = "SELECT " + hint + q.SQL[len("SELECT "):]
+	return nil
 }
 
 type QueryResult struct {
@@ -0,0 +1,154 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"web/orm"
+)
+
+// ErrOpen 熔断器打开了，语句没有发到数据库
+var ErrOpen = errors.New("orm：熔断器打开，拒绝执行")
+
+type state int
+
+const (
+	stateClosed state = iota
+	stateOpen
+	// stateHalfOpen 熔断时间到了，放少量语句去探测数据库是否恢复
+	stateHalfOpen
+)
+
+// MiddlewareBuilder 连续失败一定次数之后熔断，熔断期间直接返回 ErrOpen，
+// 熔断时间结束之后放少量语句探测，成功了就恢复，失败了继续熔断。
+// 每次 Build 出来的中间件都有自己的状态，给每个 DB 单独 Build 一个
+type MiddlewareBuilder struct {
+	threshold     int
+	openTimeout   time.Duration
+	halfOpenMax   int
+	slowThreshold time.Duration
+	isFailure     func(err error) bool
+	now           func() time.Time
+}
+
+// NewMiddlewareBuilder threshold 连续失败多少次之后熔断
+func NewMiddlewareBuilder(threshold int) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		threshold:   threshold,
+		openTimeout: 10 * time.Second,
+		halfOpenMax: 1,
+		isFailure:   IsFailure,
+		now:         time.Now,
+	}
+}
+
+// OpenTimeout 熔断多久之后开始探测，默认 10 秒
+func (m *MiddlewareBuilder) OpenTimeout(d time.Duration) *MiddlewareBuilder {
+	m.openTimeout = d
+	return m
+}
+
+// HalfOpenMax 探测的时候最多同时放行多少条语句，默认 1
+func (m *MiddlewareBuilder) HalfOpenMax(n int) *MiddlewareBuilder {
+	m.halfOpenMax = n
+	return m
+}
+
+// SlowThreshold 执行时间超过这个值也算失败，0 表示不考虑执行时间
+func (m *MiddlewareBuilder) SlowThreshold(d time.Duration) *MiddlewareBuilder {
+	m.slowThreshold = d
+	return m
+}
+
+// FailureFunc 判断哪些错误算失败，默认是 IsFailure
+func (m *MiddlewareBuilder) FailureFunc(fn func(err error) bool) *MiddlewareBuilder {
+	m.isFailure = fn
+	return m
+}
+
+// IsFailure 默认的失败判断，ErrNoRows 和调用方主动取消都不是数据库的问题
+func IsFailure(err error) bool {
+	return err != nil && !errors.Is(err, orm.ErrNoRows) && !errors.Is(err, context.Canceled)
+}
+
+func (m MiddlewareBuilder) Build() orm.Middleware {
+	b := &breaker{MiddlewareBuilder: m}
+	return func(next orm.Handler) orm.Handler {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			if !b.allow() {
+				return &orm.QueryResult{Err: ErrOpen}
+			}
+			startTime := m.now()
+			// next 里面 panic 也算失败，不然半开状态下的 probing 就减不回去了
+			failed := true
+			defer func() {
+				b.done(failed)
+			}()
+			res := next(ctx, qc)
+			failed = m.isFailure(res.Err) ||
+				m.slowThreshold > 0 && m.now().Sub(startTime) > m.slowThreshold
+			return res
+		}
+	}
+}
+
+type breaker struct {
+	MiddlewareBuilder
+	mu       sync.Mutex
+	state    state
+	failures int
+	openedAt time.Time
+	// probing 半开状态下正在执行的语句数量
+	probing int
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == stateOpen {
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.state = stateHalfOpen
+		b.probing = 0
+	}
+	if b.state == stateHalfOpen {
+		if b.probing >= b.halfOpenMax {
+			return false
+		}
+		b.probing++
+	}
+	return true
+}
+
+func (b *breaker) done(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateHalfOpen:
+		b.probing--
+		if failed {
+			b.open()
+		} else {
+			b.state = stateClosed
+			b.failures = 0
+		}
+	case stateClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	}
+	// 熔断之后才结束的语句不影响状态
+}
+
+func (b *breaker) open() {
+	b.state = stateOpen
+	b.openedAt = b.now()
+	b.failures = 0
+}
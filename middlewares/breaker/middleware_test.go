@@ -0,0 +1,112 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"web/orm"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	now := time.UnixMilli(1000)
+	builder := NewMiddlewareBuilder(2).OpenTimeout(time.Second).SlowThreshold(time.Minute)
+	builder.now = func() time.Time { return now }
+
+	var mockErr error
+	var elapsed time.Duration
+	calls := 0
+	h := builder.Build()(func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+		calls++
+		now = now.Add(elapsed)
+		return &orm.QueryResult{Err: mockErr}
+	})
+	exec := func() error {
+		return h(context.Background(), &orm.QueryContext{Type: "SELECT"}).Err
+	}
+
+	// 不算失败的错误
+	mockErr = orm.ErrNoRows
+	assert.Equal(t, orm.ErrNoRows, exec())
+	mockErr = context.Canceled
+	assert.Equal(t, context.Canceled, exec())
+
+	// 中间有成功的，失败次数重新计算
+	mockErr = errors.New("mock error")
+	assert.Error(t, exec())
+	mockErr = nil
+	assert.NoError(t, exec())
+	mockErr = errors.New("mock error")
+	assert.Error(t, exec())
+
+	// 慢查询也算失败，连续两次之后熔断
+	mockErr, elapsed = nil, 2*time.Minute
+	assert.NoError(t, exec())
+	elapsed = 0
+	calls = 0
+	assert.Equal(t, ErrOpen, exec())
+	assert.Equal(t, 0, calls)
+
+	// 熔断时间到了，探测失败继续熔断
+	now = now.Add(time.Second)
+	mockErr = context.DeadlineExceeded
+	assert.Equal(t, context.DeadlineExceeded, exec())
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, ErrOpen, exec())
+
+	// 探测成功之后恢复
+	now = now.Add(time.Second)
+	mockErr = nil
+	assert.NoError(t, exec())
+	assert.NoError(t, exec())
+	assert.Equal(t, 3, calls)
+}
+
+func TestBreaker_halfOpenMax(t *testing.T) {
+	now := time.UnixMilli(1000)
+	builder := NewMiddlewareBuilder(1)
+	builder.now = func() time.Time { return now }
+	b := &breaker{MiddlewareBuilder: *builder}
+
+	assert.True(t, b.allow())
+	b.done(true)
+	assert.False(t, b.allow())
+
+	now = now.Add(builder.openTimeout)
+	// 半开状态只放行一条
+	assert.True(t, b.allow())
+	assert.False(t, b.allow())
+	b.done(false)
+	assert.True(t, b.allow())
+	assert.True(t, b.allow())
+}
+
+func TestMiddlewareBuilder_Panic(t *testing.T) {
+	now := time.UnixMilli(1000)
+	builder := NewMiddlewareBuilder(1).OpenTimeout(time.Second)
+	builder.now = func() time.Time { return now }
+
+	panicked := true
+	h := builder.Build()(func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+		if panicked {
+			panic("mock panic")
+		}
+		return &orm.QueryResult{}
+	})
+	exec := func() error {
+		return h(context.Background(), &orm.QueryContext{Type: "SELECT"}).Err
+	}
+
+	// panic 算失败，熔断
+	assert.Panics(t, func() { _ = exec() })
+	assert.Equal(t, ErrOpen, exec())
+
+	// 探测的时候 panic，probing 也要减回去，下一次还能探测
+	now = now.Add(time.Second)
+	assert.Panics(t, func() { _ = exec() })
+	now = now.Add(time.Second)
+	panicked = false
+	assert.NoError(t, exec())
+	assert.NoError(t, exec())
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU 进程内的缓存，超过容量之后淘汰最久没有使用的数据
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key string
+	val any
+	// deadline 为零值表示不过期
+	deadline time.Time
+}
+
+func NewLRU(capacity int) *LRU {
+	return &LRU{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element, capacity),
+	}
+}
+
+func (l *LRU) Get(ctx context.Context, key string) (any, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.deadline.IsZero() && time.Now().After(entry.deadline) {
+		l.remove(elem)
+		return nil, false, nil
+	}
+	l.ll.MoveToFront(elem)
+	return entry.val, true, nil
+}
+
+func (l *LRU) Set(ctx context.Context, key string, val any, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var deadline time.Time
+	if ttl > 0 {
+		deadline = time.Now().Add(ttl)
+	}
+	if elem, ok := l.items[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.val, entry.deadline = val, deadline
+		l.ll.MoveToFront(elem)
+		return nil
+	}
+	l.items[key] = l.ll.PushFront(&lruEntry{key: key, val: val, deadline: deadline})
+	for l.capacity > 0 && l.ll.Len() > l.capacity {
+		l.remove(l.ll.Back())
+	}
+	return nil
+}
+
+func (l *LRU) remove(elem *list.Element) {
+	l.ll.Remove(elem)
+	delete(l.items, elem.Value.(*lruEntry).key)
+}
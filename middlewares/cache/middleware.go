@@ -0,0 +1,243 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"web/orm"
+	"web/orm/internal/sqlparse"
+)
+
+// Cache 缓存的抽象，例如 Redis
+// 缓存的是查询出来的结构体指针，不在进程内的实现需要自己处理序列化
+type Cache interface {
+	Get(ctx context.Context, key string) (any, bool, error)
+	// Set ttl 为 0 表示不过期
+	Set(ctx context.Context, key string, val any, ttl time.Duration) error
+}
+
+// MiddlewareBuilder 缓存 SELECT 的结果，只有通过 WithCache 开启了缓存的查询才会被缓存
+// INSERT、UPDATE、DELETE 以及原生的写语句经过中间件的时候，语句里面用到的表的缓存都会失效，
+// 联表查询的缓存在任何一张表被修改之后都会失效。
+// 失效是通过给表维护一个版本号实现的，版本号也存放在 Cache 里面，
+// 所以多个实例共用一个 Redis 的时候也能正确失效
+type MiddlewareBuilder struct {
+	cache  Cache
+	ttl    time.Duration
+	prefix string
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		cache:  NewLRU(1024),
+		ttl:    time.Minute,
+		prefix: "orm:",
+	}
+}
+
+// Cache 指定缓存，默认是容量为 1024 的 LRU
+func (m *MiddlewareBuilder) Cache(c Cache) *MiddlewareBuilder {
+	m.cache = c
+	return m
+}
+
+// TTL 默认的过期时间
+func (m *MiddlewareBuilder) TTL(ttl time.Duration) *MiddlewareBuilder {
+	m.ttl = ttl
+	return m
+}
+
+// Prefix 缓存 key 的前缀，多个 DB 共用一个缓存的时候用来区分
+func (m *MiddlewareBuilder) Prefix(prefix string) *MiddlewareBuilder {
+	m.prefix = prefix
+	return m
+}
+
+type cacheKey struct{}
+
+type options struct {
+	ttl time.Duration
+}
+
+// WithCache 开启这一次查询的缓存，ttl 为 0 的时候使用中间件的默认值
+func WithCache(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, cacheKey{}, options{ttl: ttl})
+}
+
+func (m MiddlewareBuilder) Build() orm.Middleware {
+	return func(next orm.Handler) orm.Handler {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			if qc.Model == nil {
+				return next(ctx, qc)
+			}
+			switch qc.Type {
+			case "SELECT":
+				return m.query(ctx, qc, next)
+			case "INSERT", "UPDATE", "DELETE", "RAW":
+				q, err := qc.Query()
+				if err != nil {
+					return &orm.QueryResult{Err: err}
+				}
+				stmt := sqlparse.Parse(q.SQL)
+				// 原生的查询不缓存，也不需要失效
+				if qc.Type == "RAW" && stmt.Verb == "SELECT" {
+					return next(ctx, qc)
+				}
+				res := next(ctx, qc)
+				m.invalidate(ctx, m.tables(qc, stmt))
+				return res
+			}
+			return next(ctx, qc)
+		}
+	}
+}
+
+func (m MiddlewareBuilder) query(ctx context.Context, qc *orm.QueryContext, next orm.Handler) *orm.QueryResult {
+	opts, ok := ctx.Value(cacheKey{}).(options)
+	// 事务里面可能读到还没有提交的数据，不能缓存
+	if !ok || inTx(ctx) {
+		return next(ctx, qc)
+	}
+	q, err := qc.Query()
+	if err != nil {
+		return &orm.QueryResult{Err: err}
+	}
+	key, ok := m.key(ctx, qc, q)
+	// 拿不到版本号的时候没办法保证失效，直接查数据库
+	if !ok {
+		return next(ctx, qc)
+	}
+	if val, ok, err := m.cache.Get(ctx, key); err == nil && ok {
+		return &orm.QueryResult{Result: clone(val)}
+	}
+	res := next(ctx, qc)
+	if res.Err == nil && res.Result != nil {
+		ttl := opts.ttl
+		if ttl <= 0 {
+			ttl = m.ttl
+		}
+		_ = m.cache.Set(ctx, key, clone(res.Result), ttl)
+	}
+	return res
+}
+
+// key 前缀 + 每张表的版本号 + SQL + 参数
+// 同一条 SQL 的 Get 和 GetMulti 结果类型不一样，要分开缓存
+func (m MiddlewareBuilder) key(ctx context.Context, qc *orm.QueryContext, q *orm.Query) (string, bool) {
+	var sb strings.Builder
+	sb.WriteString(m.prefix)
+	for _, table := range m.tables(qc, sqlparse.Parse(q.SQL)) {
+		ver, ok := m.version(ctx, table)
+		if !ok {
+			return "", false
+		}
+		sb.WriteString(table)
+		sb.WriteByte('@')
+		sb.WriteString(ver)
+		sb.WriteByte(':')
+	}
+	if qc.Multi {
+		sb.WriteString("multi:")
+	}
+	sb.WriteString(q.SQL)
+	for _, arg := range q.Args {
+		_, _ = fmt.Fprintf(&sb, ":%#v", arg)
+	}
+	return sb.String(), true
+}
+
+// tables 语句里面用到的所有表，包括联表和子查询里面的，去重之后排好序
+// 解析不出来的时候退回到模型的表名
+func (m MiddlewareBuilder) tables(qc *orm.QueryContext, stmt sqlparse.Statement) []string {
+	tables := stmt.AllTables()
+	if len(tables) == 0 {
+		return []string{qc.Model.TableName}
+	}
+	slices.Sort(tables)
+	return slices.Compact(tables)
+}
+
+func (m MiddlewareBuilder) versionKey(table string) string {
+	return m.prefix + "version:" + table
+}
+
+// version 表的版本号，第一次用到或者被缓存淘汰了的时候随机生成一个，
+// 这样版本号丢了之后也不会和旧的缓存撞上
+func (m MiddlewareBuilder) version(ctx context.Context, table string) (string, bool) {
+	val, ok, err := m.cache.Get(ctx, m.versionKey(table))
+	if err != nil {
+		return "", false
+	}
+	if ok {
+		return fmt.Sprint(val), true
+	}
+	ver := newVersion()
+	if err = m.cache.Set(ctx, m.versionKey(table), ver, 0); err != nil {
+		return "", false
+	}
+	return ver, true
+}
+
+func newVersion() string {
+	return strconv.FormatUint(rand.Uint64(), 36)
+}
+
+// invalidate 更新表的版本号，旧的缓存就不会再被用到，等着过期或者被淘汰
+// 在事务里面的时候，提交之后要再失效一次，避免提交之前别人把旧数据又放进了缓存
+func (m MiddlewareBuilder) invalidate(ctx context.Context, tables []string) {
+	bump := func() {
+		for _, table := range tables {
+			_ = m.cache.Set(ctx, m.versionKey(table), newVersion(), 0)
+		}
+	}
+	bump()
+	if sess, ok := orm.SessionFromContext(ctx); ok {
+		if tx, ok := sess.(*orm.Tx); ok {
+			tx.OnCommit(bump)
+		}
+	}
+}
+
+func inTx(ctx context.Context) bool {
+	if _, ok := orm.TxFromContext(ctx); ok {
+		return true
+	}
+	sess, ok := orm.SessionFromContext(ctx)
+	if !ok {
+		return false
+	}
+	_, ok = sess.(*orm.Tx)
+	return ok
+}
+
+// clone 浅拷贝查询结果，避免调用者修改了缓存里面的数据
+func clone(val any) any {
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return val
+		}
+		res := reflect.New(rv.Elem().Type())
+		res.Elem().Set(rv.Elem())
+		return res.Interface()
+	case reflect.Slice:
+		res := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			elem := rv.Index(i)
+			if elem.Kind() == reflect.Ptr && !elem.IsNil() {
+				cp := reflect.New(elem.Elem().Type())
+				cp.Elem().Set(elem.Elem())
+				elem = cp
+			}
+			res.Index(i).Set(elem)
+		}
+		return res.Interface()
+	}
+	return val
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"web/orm"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(NewMiddlewareBuilder().Build()))
+	require.NoError(t, err)
+
+	get := func(ctx context.Context, id int64) *User {
+		u, err := orm.NewSelector[User](db).Where(orm.C("Id").Eq(id)).Get(ctx)
+		require.NoError(t, err)
+		return u
+	}
+	expectGet := func(name string) {
+		mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, name))
+	}
+	ctx := WithCache(context.Background(), 0)
+
+	// 第二次命中缓存，拿到的是副本
+	expectGet("Tom")
+	u := get(ctx, 1)
+	u.Name = "Jerry"
+	assert.Equal(t, &User{Id: 1, Name: "Tom"}, get(ctx, 1))
+
+	// 参数不一样不会命中
+	expectGet("Tom")
+	get(ctx, 2)
+
+	// 没有开启缓存的查询
+	expectGet("Tom")
+	get(context.Background(), 1)
+
+	// 更新之后缓存失效
+	mock.ExpectExec("UPDATE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, orm.NewUpdater[User](db).Set(orm.Assign("Name", "Jerry")).
+		Where(orm.C("Id").Eq(1)).Exec(context.Background()).Err())
+	expectGet("Jerry")
+	assert.Equal(t, "Jerry", get(ctx, 1).Name)
+	assert.Equal(t, "Jerry", get(ctx, 1).Name)
+
+	// 事务里面不使用缓存
+	mock.ExpectBegin()
+	expectGet("Jerry")
+	mock.ExpectCommit()
+	require.NoError(t, db.DoTx(ctx, func(ctx context.Context, tx *orm.Tx) error {
+		get(ctx, 1)
+		return nil
+	}, nil))
+
+	// 过期
+	ctx = WithCache(context.Background(), time.Millisecond)
+	expectGet("Jerry")
+	get(ctx, 3)
+	time.Sleep(5 * time.Millisecond)
+	expectGet("Jerry")
+	get(ctx, 3)
+
+	// 同样的 SQL，GetMulti 和 Get 分开缓存
+	ctx = WithCache(context.Background(), 0)
+	expectGet("Jerry")
+	for i := 0; i < 2; i++ {
+		us, err := orm.NewSelector[User](db).Where(orm.C("Id").Eq(1)).GetMulti(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []*User{{Id: 1, Name: "Jerry"}}, us)
+	}
+	assert.Equal(t, "Jerry", get(ctx, 1).Name)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	l := NewLRU(2)
+	require.NoError(t, l.Set(ctx, "a", 1, 0))
+	require.NoError(t, l.Set(ctx, "b", 2, 0))
+	_, ok, _ := l.Get(ctx, "a")
+	assert.True(t, ok)
+	// b 最久没有使用，被淘汰
+	require.NoError(t, l.Set(ctx, "c", 3, 0))
+	_, ok, _ = l.Get(ctx, "b")
+	assert.False(t, ok)
+	val, ok, _ := l.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, val)
+	val, ok, _ = l.Get(ctx, "c")
+	assert.True(t, ok)
+	assert.Equal(t, 3, val)
+}
+
+func TestMiddlewareBuilder_Invalidate(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	l := NewLRU(16)
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(NewMiddlewareBuilder().Cache(l).Build()))
+	require.NoError(t, err)
+	ctx := WithCache(context.Background(), 0)
+
+	getUser := func() string {
+		u, err := orm.NewSelector[User](db).Where(orm.C("Id").Eq(1)).Get(ctx)
+		require.NoError(t, err)
+		return u.Name
+	}
+	expectGet := func(name string) {
+		mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, name))
+	}
+	update := func(sql string) {
+		mock.ExpectExec(sql).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	// 版本号被淘汰之后重新生成的版本号不会和旧的缓存撞上
+	expectGet("Tom")
+	assert.Equal(t, "Tom", getUser())
+	update("UPDATE `user` .*")
+	require.NoError(t, orm.NewUpdater[User](db).Set(orm.Assign("Name", "Jerry")).
+		Where(orm.C("Id").Eq(1)).Exec(context.Background()).Err())
+	l.mu.Lock()
+	l.remove(l.items["orm:version:user"])
+	l.mu.Unlock()
+	expectGet("Jerry")
+	assert.Equal(t, "Jerry", getUser())
+
+	// 联表查询的缓存在被联的表修改之后也会失效
+	join := orm.TableOf(&User{}).Join(orm.TableOf(&Order{})).
+		On(orm.TableOf(&User{}).C("Id").Eq(orm.TableOf(&Order{}).C("UserId")))
+	getJoin := func() string {
+		us, err := orm.NewSelector[User](db).From(join).Where(orm.C("Id").Eq(1)).GetMulti(ctx)
+		require.NoError(t, err)
+		require.Len(t, us, 1)
+		return us[0].Name
+	}
+	expectGet("Tom")
+	assert.Equal(t, "Tom", getJoin())
+	assert.Equal(t, "Tom", getJoin())
+	update("UPDATE `order` .*")
+	require.NoError(t, orm.NewUpdater[Order](db).Set(orm.Assign("UserId", 2)).
+		Where(orm.C("Id").Eq(1)).Exec(context.Background()).Err())
+	expectGet("Jerry")
+	assert.Equal(t, "Jerry", getJoin())
+
+	// 原生的写语句按照 SQL 里面的表失效，和结果的类型无关
+	update("DELETE FROM `order` .*")
+	require.NoError(t, orm.RawQuery[User](db, "DELETE FROM `order` WHERE `id` = ?", 1).
+		Exec(context.Background()).Err())
+	expectGet("Bob")
+	assert.Equal(t, "Bob", getJoin())
+	assert.Equal(t, "Bob", getJoin())
+
+	// 逗号分隔的多张表，后面的表也会失效
+	update("UPDATE `shop` .*")
+	require.NoError(t, orm.RawQuery[User](db, "UPDATE `shop` s, `order` o SET o.`user_id` = s.`owner_id`").
+		Exec(context.Background()).Err())
+	expectGet("Alice")
+	assert.Equal(t, "Alice", getJoin())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type Order struct {
+	Id     int64
+	UserId int64
+}
+
+type User struct {
+	Id   int64
+	Name string
+}
@@ -0,0 +1,105 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"web/orm"
+)
+
+// ErrLimitExceeded 等待超时了还是拿不到执行的名额
+var ErrLimitExceeded = errors.New("orm：并发执行的语句太多")
+
+// MiddlewareBuilder 限制同时执行的语句数量，超过的语句最多等待 MaxWait。
+// 每次 Build 出来的中间件都有自己的计数，所以给每个 DB 单独 Build 一个就是按 DB 限流
+type MiddlewareBuilder struct {
+	limit   int
+	maxWait time.Duration
+	keyFunc func(qc *orm.QueryContext) string
+}
+
+// NewMiddlewareBuilder limit 是同一个 key 下最多同时执行的语句数量
+func NewMiddlewareBuilder(limit int) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		limit:   limit,
+		keyFunc: func(qc *orm.QueryContext) string { return "" },
+	}
+}
+
+// MaxWait 拿不到名额的时候最多等多久，0 表示不等待直接返回错误
+// context 先结束的话会返回 context 的错误
+func (m *MiddlewareBuilder) MaxWait(d time.Duration) *MiddlewareBuilder {
+	m.maxWait = d
+	return m
+}
+
+// KeyFunc 按照 key 分别计数，例如 ByTable、ByType
+func (m *MiddlewareBuilder) KeyFunc(fn func(qc *orm.QueryContext) string) *MiddlewareBuilder {
+	m.keyFunc = fn
+	return m
+}
+
+// ByTable 每张表分别限制
+func ByTable(qc *orm.QueryContext) string {
+	if qc.Model == nil {
+		return ""
+	}
+	return qc.Model.TableName
+}
+
+// ByType 每种语句分别限制，例如 SELECT 和 UPDATE 互不影响
+func ByType(qc *orm.QueryContext) string {
+	return qc.Type
+}
+
+func (m MiddlewareBuilder) Build() orm.Middleware {
+	var mu sync.Mutex
+	sems := make(map[string]chan struct{})
+	semOf := func(key string) chan struct{} {
+		mu.Lock()
+		defer mu.Unlock()
+		sem, ok := sems[key]
+		if !ok {
+			sem = make(chan struct{}, m.limit)
+			sems[key] = sem
+		}
+		return sem
+	}
+	return func(next orm.Handler) orm.Handler {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			key := m.keyFunc(qc)
+			sem := semOf(key)
+			if err := m.acquire(ctx, sem); err != nil {
+				if errors.Is(err, ErrLimitExceeded) && key != "" {
+					err = fmt.Errorf("%w：%s", err, key)
+				}
+				return &orm.QueryResult{Err: err}
+			}
+			defer func() { <-sem }()
+			return next(ctx, qc)
+		}
+	}
+}
+
+func (m MiddlewareBuilder) acquire(ctx context.Context, sem chan struct{}) error {
+	select {
+	case sem <- struct{}{}:
+		return nil
+	default:
+	}
+	if m.maxWait <= 0 {
+		return ErrLimitExceeded
+	}
+	timer := time.NewTimer(m.maxWait)
+	defer timer.Stop()
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrLimitExceeded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,100 @@
+package concurrency
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"web/orm"
+	"web/orm/model"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name    string
+		builder *MiddlewareBuilder
+		// 第一条语句还没执行完的时候执行第二条
+		second  *orm.QueryContext
+		timeout time.Duration
+		wantErr error
+	}{
+		{
+			name:    "no wait",
+			builder: NewMiddlewareBuilder(1),
+			second:  &orm.QueryContext{Type: "SELECT", Model: &model.Model{TableName: "user"}},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:    "wait timeout",
+			builder: NewMiddlewareBuilder(1).MaxWait(10 * time.Millisecond),
+			second:  &orm.QueryContext{Type: "SELECT", Model: &model.Model{TableName: "user"}},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:    "context done",
+			builder: NewMiddlewareBuilder(1).MaxWait(time.Minute),
+			second:  &orm.QueryContext{Type: "SELECT", Model: &model.Model{TableName: "user"}},
+			timeout: 10 * time.Millisecond,
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name:    "other table",
+			builder: NewMiddlewareBuilder(1).KeyFunc(ByTable),
+			second:  &orm.QueryContext{Type: "SELECT", Model: &model.Model{TableName: "order"}},
+		},
+		{
+			name:    "same table",
+			builder: NewMiddlewareBuilder(1).KeyFunc(ByTable),
+			second:  &orm.QueryContext{Type: "UPDATE", Model: &model.Model{TableName: "user"}},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:    "other type",
+			builder: NewMiddlewareBuilder(1).KeyFunc(ByType),
+			second:  &orm.QueryContext{Type: "UPDATE", Model: &model.Model{TableName: "user"}},
+		},
+		{
+			name:    "enough",
+			builder: NewMiddlewareBuilder(2),
+			second:  &orm.QueryContext{Type: "SELECT", Model: &model.Model{TableName: "user"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			started, release := make(chan struct{}), make(chan struct{})
+			h := tc.builder.Build()(func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+				if qc.Type == "SELECT" && qc.Model.TableName == "user" && ctx.Value(firstKey{}) != nil {
+					close(started)
+					<-release
+				}
+				return &orm.QueryResult{}
+			})
+			first := &orm.QueryContext{Type: "SELECT", Model: &model.Model{TableName: "user"}}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				h(context.WithValue(context.Background(), firstKey{}, true), first)
+			}()
+			<-started
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			res := h(ctx, tc.second)
+			assert.ErrorIs(t, res.Err, tc.wantErr)
+			if tc.wantErr == nil {
+				assert.NoError(t, res.Err)
+			}
+
+			close(release)
+			<-done
+			// 名额释放之后可以继续执行
+			assert.NoError(t, h(context.Background(), tc.second).Err)
+		})
+	}
+}
+
+type firstKey struct{}
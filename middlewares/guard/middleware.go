@@ -0,0 +1,107 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"web/orm"
+	"web/orm/internal/sqlparse"
+)
+
+// ErrBlocked 语句被拦截了，具体的原因会包装在错误信息里面
+var ErrBlocked = errors.New("orm：危险的语句被拦截")
+
+// MiddlewareBuilder 检查最终执行的 SQL，拦截危险的语句
+// - 没有 WHERE 的 UPDATE 和 DELETE
+// - 大表上没有 LIMIT 的 SELECT，注意 Selector.Get 默认也不带 LIMIT
+// - 命中黑名单的语句
+type MiddlewareBuilder struct {
+	largeTables map[string]bool
+	deny        []*regexp.Regexp
+	reportOnly  bool
+	logger      *slog.Logger
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		largeTables: map[string]bool{},
+	}
+}
+
+// LargeTables 标记大表，这些表上的 SELECT 必须带 LIMIT
+func (m *MiddlewareBuilder) LargeTables(tables ...string) *MiddlewareBuilder {
+	for _, t := range tables {
+		m.largeTables[strings.ToLower(t)] = true
+	}
+	return m
+}
+
+// Deny 黑名单，SQL 命中任意一个正则表达式都会被拦截
+// 例如 regexp.MustCompile(`(?i)^\s*(DROP|TRUNCATE)\b`)
+func (m *MiddlewareBuilder) Deny(patterns ...*regexp.Regexp) *MiddlewareBuilder {
+	m.deny = append(m.deny, patterns...)
+	return m
+}
+
+// ReportOnly 只输出日志不拦截，用于上线之前观察会影响哪些语句
+func (m *MiddlewareBuilder) ReportOnly() *MiddlewareBuilder {
+	m.reportOnly = true
+	return m
+}
+
+// Logger 输出拦截日志使用的 slog，默认是 slog.Default()
+func (m *MiddlewareBuilder) Logger(logger *slog.Logger) *MiddlewareBuilder {
+	m.logger = logger
+	return m
+}
+
+func (m MiddlewareBuilder) Build() orm.Middleware {
+	logger := m.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next orm.Handler) orm.Handler {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			q, err := qc.Query()
+			if err != nil {
+				return &orm.QueryResult{Err: err}
+			}
+			if err = m.check(q.SQL); err != nil {
+				logger.WarnContext(ctx, "orm: 危险的语句", slog.String("sql", q.SQL),
+					slog.String("reason", err.Error()), slog.Bool("report_only", m.reportOnly))
+				if !m.reportOnly {
+					return &orm.QueryResult{Err: err}
+				}
+			}
+			return next(ctx, qc)
+		}
+	}
+}
+
+func (m MiddlewareBuilder) check(sql string) error {
+	for _, p := range m.deny {
+		if p.MatchString(sql) {
+			return fmt.Errorf("%w：命中黑名单 %s", ErrBlocked, p.String())
+		}
+	}
+	stmt := sqlparse.Parse(sql)
+	switch stmt.Verb {
+	case "UPDATE", "DELETE":
+		if !stmt.HasKeyword("WHERE") {
+			return fmt.Errorf("%w：%s 没有 WHERE", ErrBlocked, stmt.Verb)
+		}
+	case "SELECT":
+		if stmt.HasKeyword("LIMIT") {
+			return nil
+		}
+		for _, t := range stmt.Tables() {
+			if m.largeTables[t] {
+				return fmt.Errorf("%w：大表 %s 上的 SELECT 没有 LIMIT", ErrBlocked, t)
+			}
+		}
+	}
+	return nil
+}
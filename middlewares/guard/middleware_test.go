@@ -0,0 +1,129 @@
+package guard
+
+import (
+	"bytes"
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"regexp"
+	"testing"
+	"web/orm"
+)
+
+func TestMiddlewareBuilder_check(t *testing.T) {
+	m := NewMiddlewareBuilder().LargeTables("order").
+		Deny(regexp.MustCompile(`(?i)^\s*(DROP|TRUNCATE)\b`))
+	testCases := []struct {
+		name    string
+		sql     string
+		wantErr bool
+	}{
+		{name: "update without where", sql: "UPDATE `user` SET `name`=?;", wantErr: true},
+		{name: "update with where", sql: "UPDATE `user` SET `name`=? WHERE `id` = ?;"},
+		{
+			name:    "where in subquery",
+			sql:     "UPDATE `user` SET `age`=(SELECT MAX(`age`) FROM `user` WHERE `id` = 1);",
+			wantErr: true,
+		},
+		{name: "where in string", sql: "update user set name = 'a where b'", wantErr: true},
+		{name: "where in comment", sql: "DELETE FROM `user` /* WHERE */ -- WHERE\n;", wantErr: true},
+		{name: "delete without where", sql: "DELETE FROM `user`;", wantErr: true},
+		{name: "delete with where", sql: "delete from user where id = 1"},
+		{name: "large table", sql: "SELECT * FROM `order` WHERE `id` = ?;", wantErr: true},
+		{name: "large table with db", sql: "SELECT * FROM `shop`.`order`;", wantErr: true},
+		{name: "large table join", sql: "SELECT * FROM `user` JOIN `order` ON `user`.`id` = `order`.`uid`;", wantErr: true},
+		{
+			name:    "large table in join group",
+			sql:     "SELECT * FROM (`user` JOIN `order` ON `user`.`id`=`order`.`uid`) WHERE `user`.`id` = ?;",
+			wantErr: true,
+		},
+		{
+			name:    "large table in nested join group",
+			sql:     "SELECT * FROM ((`user` JOIN `address` ON `user`.`id`=`address`.`uid`) JOIN `shop`.`order` USING (`uid`));",
+			wantErr: true,
+		},
+		{name: "large table in subquery", sql: "SELECT * FROM (SELECT * FROM `order` LIMIT 1) AS `o`;"},
+		{name: "large table with limit", sql: "SELECT * FROM `order` LIMIT ?;"},
+		{name: "limit in subquery", sql: "SELECT * FROM `order` WHERE `id` IN (SELECT `id` FROM `user` LIMIT 1);", wantErr: true},
+		{name: "small table", sql: "SELECT * FROM `user`;"},
+		{name: "insert", sql: "INSERT INTO `order`(`id`) VALUES(?);"},
+		{name: "deny", sql: "  truncate table `user`", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := m.check(tc.sql)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrBlocked)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name       string
+		reportOnly bool
+		wantErr    error
+	}{
+		{name: "block", wantErr: ErrBlocked},
+		{name: "report only", reportOnly: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			builder := NewMiddlewareBuilder().Logger(slog.New(slog.NewTextHandler(buf, nil)))
+			if tc.reportOnly {
+				builder = builder.ReportOnly()
+			}
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer mockDB.Close()
+			db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(builder.Build()))
+			require.NoError(t, err)
+			if tc.reportOnly {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `user` SET `name`=?;")).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+			}
+
+			res := orm.RawQuery[User](db, "UPDATE `user` SET `name`=?;", "Tom").Exec(context.Background())
+			assert.ErrorIs(t, res.Err(), tc.wantErr)
+			assert.Contains(t, buf.String(), "UPDATE `user` SET `name`=?;")
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Join(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	mdl := NewMiddlewareBuilder().LargeTables("order").
+		Logger(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))).Build()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(mdl))
+	require.NoError(t, err)
+
+	// Selector 构造的 JOIN 会带着括号
+	join := orm.TableOf(&User{}).Join(orm.TableOf(&Order{})).
+		On(orm.TableOf(&User{}).C("Id").Eq(orm.TableOf(&Order{}).C("UserId")))
+	_, err = orm.NewSelector[User](db).From(join).GetMulti(context.Background())
+	assert.ErrorIs(t, err, ErrBlocked)
+
+	mock.ExpectQuery("SELECT .* LIMIT").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = orm.NewSelector[User](db).From(join).Limit(10).GetMulti(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type Order struct {
+	Id     int64
+	UserId int64
+}
+
+type User struct {
+	Id   int64
+	Name string
+}
@@ -2,37 +2,147 @@ package opentelemetry
 
 import (
 	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
+	"time"
 	"web/orm"
+	"web/orm/middlewares/sqlcomment"
 )
 
 const instrumentationName = "orm/middlewares/openTelemetry"
 
+// 语义约定里面数据库相关的属性
+const (
+	keyDBSystem       = attribute.Key("db.system")
+	keyDBStatement    = attribute.Key("db.statement")
+	keyDBOperation    = attribute.Key("db.operation")
+	keyDBSQLTable     = attribute.Key("db.sql.table")
+	keyDBRowsAffected = attribute.Key("db.rows_affected")
+	keyErrorType      = attribute.Key("error.type")
+)
+
 type MiddlewareBuilder struct {
 	Tracer trace.Tracer
+	// Meter 用于记录执行时间，默认使用全局的 MeterProvider
+	Meter metric.Meter
+	// DBSystem 数据库的类型，例如 mysql、sqlite，默认是 other_sql
+	DBSystem string
+	// Sanitize 处理 db.statement，例如去掉 SQL 里面拼接进去的字面量
+	// 为 nil 的时候原样记录，orm 构造的 SQL 参数都是占位符
+	Sanitize func(query string) string
+	// OmitStatement 不记录 db.statement
+	OmitStatement bool
+	// Propagate 以注释的形式把 trace context 带到 SQL 里面，
+	// 这样数据库那边的慢查询日志也能关联到链路，
+	// 注意这会让每一条 SQL 都不一样，影响数据库的语句缓存
+	Propagate bool
+	// Propagator 默认是 otel.GetTextMapPropagator()
+	Propagator propagation.TextMapPropagator
+	// ErrorClassifier 把错误归类，作为 error.type 属性
+	// 默认按照超时、取消、连接失效分类，其余的都是 _OTHER，返回值的种类要有限
+	ErrorClassifier func(err error) string
 }
 
 func (m MiddlewareBuilder) Build() orm.Middleware {
 	if m.Tracer == nil {
 		m.Tracer = otel.GetTracerProvider().Tracer(instrumentationName)
 	}
+	if m.Meter == nil {
+		m.Meter = otel.GetMeterProvider().Meter(instrumentationName)
+	}
+	if m.DBSystem == "" {
+		m.DBSystem = "other_sql"
+	}
+	if m.Propagator == nil {
+		m.Propagator = otel.GetTextMapPropagator()
+	}
+	if m.ErrorClassifier == nil {
+		m.ErrorClassifier = classifyError
+	}
+	duration, err := m.Meter.Float64Histogram("db.client.operation.duration",
+		metric.WithUnit("s"), metric.WithDescription("语句的执行时间"))
+	if err != nil {
+		otel.Handle(err)
+	}
 	return func(next orm.Handler) orm.Handler {
 		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
-
-			spanName := fmt.Sprintf("%s_%s", qc.Type, qc.Model.TableName)
-			spanCtx, span := m.Tracer.Start(ctx, spanName)
+			var table string
+			if qc.Model != nil {
+				table = qc.Model.TableName
+			}
+			attrs := []attribute.KeyValue{
+				keyDBSystem.String(m.DBSystem),
+				keyDBOperation.String(qc.Type),
+				keyDBSQLTable.String(table),
+			}
+			spanCtx, span := m.Tracer.Start(ctx, fmt.Sprintf("%s %s", qc.Type, table),
+				trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
 			defer span.End()
 
-			span.SetAttributes(attribute.String("table", spanName))
+			q, err := qc.Query()
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return &orm.QueryResult{Err: err}
+			}
+			if !m.OmitStatement {
+				statement := q.SQL
+				if m.Sanitize != nil {
+					statement = m.Sanitize(statement)
+				}
+				span.SetAttributes(keyDBStatement.String(statement))
+			}
+			if m.Propagate {
+				q.SQL = m.inject(spanCtx, q.SQL)
+			}
 
+			startTime := time.Now()
 			res := next(spanCtx, qc)
-			if res.Err != nil {
+			elapsed := time.Since(startTime).Seconds()
+
+			if res.Err != nil && !errors.Is(res.Err, orm.ErrNoRows) {
 				span.RecordError(res.Err)
+				span.SetStatus(codes.Error, res.Err.Error())
+				attrs = append(attrs, keyErrorType.String(m.ErrorClassifier(res.Err)))
+			} else if r, ok := res.Result.(orm.Result); ok {
+				if affected, er := r.RowsAffected(); er == nil {
+					span.SetAttributes(keyDBRowsAffected.Int64(affected))
+				}
+			}
+			if duration != nil {
+				duration.Record(ctx, elapsed, metric.WithAttributes(attrs...))
 			}
 			return res
 		}
 	}
 }
+
+// classifyError 语义约定要求 error.type 的取值有限，
+// 不能直接用错误的类型或者错误信息
+func classifyError(err error) string {
+	switch {
+	case errors.Is(err, orm.ErrQueryTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, driver.ErrBadConn):
+		return "bad_conn"
+	default:
+		return "_OTHER"
+	}
+}
+
+// inject 按照 sqlcommenter 的格式把 trace context 加到 SQL 末尾
+// 例如 SELECT * FROM `user` /* traceparent='00-...-01' */;
+func (m MiddlewareBuilder) inject(ctx context.Context, query string) string {
+	carrier := propagation.MapCarrier{}
+	m.Propagator.Inject(ctx, carrier)
+	return sqlcomment.Append(query, carrier)
+}
@@ -0,0 +1,169 @@
+package opentelemetry
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"regexp"
+	"testing"
+	"web/orm"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name    string
+		builder MiddlewareBuilder
+		mockErr error
+		// wantSQL 正则表达式
+		wantSQL   string
+		wantAttrs map[attribute.Key]attribute.Value
+		wantCode  codes.Code
+		// wantErrType 指标上的 error.type，空字符串表示没有
+		wantErrType string
+	}{
+		{
+			name:    "exec",
+			builder: MiddlewareBuilder{DBSystem: "mysql"},
+			wantSQL: regexp.QuoteMeta("UPDATE `user` SET `name`=? WHERE `id` = ?;"),
+			wantAttrs: map[attribute.Key]attribute.Value{
+				keyDBSystem:       attribute.StringValue("mysql"),
+				keyDBOperation:    attribute.StringValue("UPDATE"),
+				keyDBSQLTable:     attribute.StringValue("user"),
+				keyDBStatement:    attribute.StringValue("UPDATE `user` SET `name`=? WHERE `id` = ?;"),
+				keyDBRowsAffected: attribute.Int64Value(2),
+			},
+			wantCode: codes.Unset,
+		},
+		{
+			name:    "error",
+			builder: MiddlewareBuilder{OmitStatement: true},
+			mockErr: errors.New("mock error"),
+			wantSQL: regexp.QuoteMeta("UPDATE `user` SET `name`=? WHERE `id` = ?;"),
+			wantAttrs: map[attribute.Key]attribute.Value{
+				keyDBSystem:    attribute.StringValue("other_sql"),
+				keyDBOperation: attribute.StringValue("UPDATE"),
+				keyDBSQLTable:  attribute.StringValue("user"),
+			},
+			wantCode:    codes.Error,
+			wantErrType: "_OTHER",
+		},
+		{
+			name:    "timeout",
+			builder: MiddlewareBuilder{OmitStatement: true},
+			mockErr: context.DeadlineExceeded,
+			wantSQL: regexp.QuoteMeta("UPDATE `user` SET `name`=? WHERE `id` = ?;"),
+			wantAttrs: map[attribute.Key]attribute.Value{
+				keyDBSystem:    attribute.StringValue("other_sql"),
+				keyDBOperation: attribute.StringValue("UPDATE"),
+				keyDBSQLTable:  attribute.StringValue("user"),
+			},
+			wantCode:    codes.Error,
+			wantErrType: "timeout",
+		},
+		{
+			name: "error classifier",
+			builder: MiddlewareBuilder{
+				OmitStatement:   true,
+				ErrorClassifier: func(err error) string { return "custom" },
+			},
+			mockErr: errors.New("mock error"),
+			wantSQL: regexp.QuoteMeta("UPDATE `user` SET `name`=? WHERE `id` = ?;"),
+			wantAttrs: map[attribute.Key]attribute.Value{
+				keyDBSystem:    attribute.StringValue("other_sql"),
+				keyDBOperation: attribute.StringValue("UPDATE"),
+				keyDBSQLTable:  attribute.StringValue("user"),
+			},
+			wantCode:    codes.Error,
+			wantErrType: "custom",
+		},
+		{
+			name: "propagate",
+			builder: MiddlewareBuilder{
+				Propagate:  true,
+				Propagator: propagation.TraceContext{},
+				Sanitize:   func(query string) string { return "sanitized" },
+			},
+			wantSQL: regexp.QuoteMeta("UPDATE `user` SET `name`=? WHERE `id` = ? ") +
+				`/\* traceparent='00-[0-9a-f]{32}-[0-9a-f]{16}-01' \*/;`,
+			wantAttrs: map[attribute.Key]attribute.Value{
+				keyDBSystem:       attribute.StringValue("other_sql"),
+				keyDBOperation:    attribute.StringValue("UPDATE"),
+				keyDBSQLTable:     attribute.StringValue("user"),
+				keyDBStatement:    attribute.StringValue("sanitized"),
+				keyDBRowsAffected: attribute.Int64Value(2),
+			},
+			wantCode: codes.Unset,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			reader := sdkmetric.NewManualReader()
+			mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+			builder := tc.builder
+			builder.Tracer = tp.Tracer("test")
+			builder.Meter = mp.Meter("test")
+
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer mockDB.Close()
+			db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(builder.Build()))
+			require.NoError(t, err)
+
+			exp := mock.ExpectExec("^" + tc.wantSQL + "$")
+			if tc.mockErr != nil {
+				exp.WillReturnError(tc.mockErr)
+			} else {
+				exp.WillReturnResult(sqlmock.NewResult(0, 2))
+			}
+			res := orm.NewUpdater[User](db).Set(orm.Assign("Name", "Tom")).
+				Where(orm.C("Id").Eq(1)).Exec(context.Background())
+			if tc.mockErr == nil {
+				assert.NoError(t, res.Err())
+			} else {
+				// 超时会被包装成 orm.ErrQueryTimeout
+				assert.ErrorIs(t, res.Err(), tc.mockErr)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			spans := recorder.Ended()
+			require.Len(t, spans, 1)
+			assert.Equal(t, "UPDATE user", spans[0].Name())
+			assert.Equal(t, tc.wantCode, spans[0].Status().Code)
+			attrs := make(map[attribute.Key]attribute.Value, len(spans[0].Attributes()))
+			for _, kv := range spans[0].Attributes() {
+				attrs[kv.Key] = kv.Value
+			}
+			assert.Equal(t, tc.wantAttrs, attrs)
+
+			var rm metricdata.ResourceMetrics
+			require.NoError(t, reader.Collect(context.Background(), &rm))
+			require.Len(t, rm.ScopeMetrics, 1)
+			hist := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Histogram[float64])
+			assert.Equal(t, uint64(1), hist.DataPoints[0].Count)
+			errType, ok := hist.DataPoints[0].Attributes.Value(keyErrorType)
+			assert.Equal(t, tc.wantErrType != "", ok)
+			assert.Equal(t, tc.wantErrType, errType.AsString())
+		})
+	}
+}
+
+func TestSanitizeSQL(t *testing.T) {
+	assert.Equal(t, "SELECT * FROM `t1` WHERE `name` = ? AND `age` > ? AND `x` = ?",
+		SanitizeSQL("SELECT * FROM `t1` WHERE `name` = 'it''s' AND `age` > 18 AND `x` = 1.5"))
+}
+
+type User struct {
+	Id   int64
+	Name string
+}
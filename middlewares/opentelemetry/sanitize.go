@@ -0,0 +1,15 @@
+package opentelemetry
+
+import "regexp"
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	numericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+// SanitizeSQL 把 SQL 里面的字符串和数字字面量替换成 ?，
+// 可以作为 MiddlewareBuilder.Sanitize，用于原生查询里面直接拼接了参数的情况
+func SanitizeSQL(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "?")
+	return numericLiteral.ReplaceAllString(query, "?")
+}
@@ -0,0 +1,68 @@
+package promethus
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dbStatsCollector 采集 sql.DB.Stats() 里面的连接池状态
+type dbStatsCollector struct {
+	db *sql.DB
+
+	maxOpen      *prometheus.Desc
+	open         *prometheus.Desc
+	inUse        *prometheus.Desc
+	idle         *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+	maxIdleClose *prometheus.Desc
+	maxLifeClose *prometheus.Desc
+}
+
+// NewDBStatsCollector 连接池状态的采集器，dbName 会作为 db 标签区分不同的数据库
+// 指标名字使用 MiddlewareBuilder 的 Namespace 和 Subsystem
+func (m MiddlewareBuilder) NewDBStatsCollector(db *sql.DB, dbName string) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(m.Namespace, m.Subsystem, name),
+			help, nil, prometheus.Labels{"db": dbName})
+	}
+	return &dbStatsCollector{
+		db:           db,
+		maxOpen:      desc("db_max_open_connections", "最大连接数"),
+		open:         desc("db_open_connections", "当前的连接数，包括使用中和空闲的"),
+		inUse:        desc("db_in_use_connections", "使用中的连接数"),
+		idle:         desc("db_idle_connections", "空闲的连接数"),
+		waitCount:    desc("db_wait_count_total", "等待连接的总次数"),
+		waitDuration: desc("db_wait_duration_seconds_total", "等待连接的总时间"),
+		maxIdleClose: desc("db_max_idle_closed_total", "因为 SetMaxIdleConns 关闭的连接数"),
+		maxLifeClose: desc("db_max_lifetime_closed_total", "因为 SetConnMaxLifetime 关闭的连接数"),
+	}
+}
+
+// RegisterDBStats 把连接池状态的采集器注册到 Registerer 上
+func (m MiddlewareBuilder) RegisterDBStats(db *sql.DB, dbName string) error {
+	return m.registerer().Register(m.NewDBStatsCollector(db, dbName))
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClose
+	ch <- c.maxLifeClose
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClose, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxLifeClose, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
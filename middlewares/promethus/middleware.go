@@ -2,36 +2,119 @@ package promethus
 
 import (
 	"context"
+	"database/sql/driver"
+	"errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"time"
 	"web/orm"
 )
 
+// MiddlewareBuilder 输出的指标都以 Name 为前缀：
+//   - <Name>_duration_seconds 响应时间的直方图，单位是秒
+//   - <Name>_errors_total 执行出错的语句数量
+//   - <Name>_in_flight 正在执行的语句数量
+//
+// 以前的版本直接用 Name 输出毫秒的 Summary，现在不再输出，
+// 用到它的面板和告警需要换成 <Name>_duration_seconds
 type MiddlewareBuilder struct {
 	Namespace string
 	Subsystem string
 	Name      string
-	Help      string
+	// Help 响应时间直方图的说明
+	Help string
+
+	// Registerer 指标注册到哪里，默认是 prometheus.DefaultRegisterer
+	// 同一个 Registerer 上重复 Build 会复用已经注册的指标，不会 panic
+	Registerer prometheus.Registerer
+	// Buckets 响应时间直方图的桶，单位是秒，默认是 prometheus.DefBuckets
+	Buckets []float64
+	// ErrorClassifier 把错误归类，作为错误计数的 class 标签
+	// 默认按照超时、取消、连接失效和其它分类，返回值的种类要有限
+	ErrorClassifier func(err error) string
 }
 
 func (m MiddlewareBuilder) Build() orm.Middleware {
-	vector := prometheus.NewSummaryVec(prometheus.SummaryOpts{
-		Namespace:  m.Namespace,
-		Subsystem:  m.Subsystem,
-		Name:       m.Name,
-		Help:       m.Help,
-		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
-	}, []string{"type", "table"})
-	prometheus.MustRegister(vector)
+	buckets := m.Buckets
+	if buckets == nil {
+		buckets = prometheus.DefBuckets
+	}
+	classify := m.ErrorClassifier
+	if classify == nil {
+		classify = ClassifyError
+	}
+	duration := register(m.registerer(), prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: m.Namespace,
+		Subsystem: m.Subsystem,
+		Name:      m.Name + "_duration_seconds",
+		Help:      m.Help,
+		Buckets:   buckets,
+	}, []string{"type", "table"}))
+	errCnt := register(m.registerer(), prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: m.Namespace,
+		Subsystem: m.Subsystem,
+		Name:      m.Name + "_errors_total",
+		Help:      "执行出错的语句数量",
+	}, []string{"type", "table", "class"}))
+	inFlight := register(m.registerer(), prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: m.Namespace,
+		Subsystem: m.Subsystem,
+		Name:      m.Name + "_in_flight",
+		Help:      "正在执行的语句数量",
+	}, []string{"type", "table"}))
 
 	return func(next orm.Handler) orm.Handler {
 		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			var table string
+			if qc.Model != nil {
+				table = qc.Model.TableName
+			}
+			gauge := inFlight.WithLabelValues(qc.Type, table)
+			gauge.Inc()
+			// next 里面 panic 的时候也要减回去
+			defer gauge.Dec()
 			startTime := time.Now()
-			defer func() {
-				vector.WithLabelValues(qc.Type, qc.Model.TableName).Observe(float64(time.Since(startTime).Milliseconds()))
-			}()
-			return next(ctx, qc)
+			res := next(ctx, qc)
+			duration.WithLabelValues(qc.Type, table).Observe(time.Since(startTime).Seconds())
+			if res.Err != nil && !errors.Is(res.Err, orm.ErrNoRows) {
+				errCnt.WithLabelValues(qc.Type, table, classify(res.Err)).Inc()
+			}
+			return res
 		}
 	}
+}
+
+func (m MiddlewareBuilder) registerer() prometheus.Registerer {
+	if m.Registerer == nil {
+		return prometheus.DefaultRegisterer
+	}
+	return m.Registerer
+}
 
+// register 注册指标，如果已经注册过了就返回之前注册的那个
+func register[T prometheus.Collector](reg prometheus.Registerer, c T) T {
+	err := reg.Register(c)
+	if err == nil {
+		return c
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			return existing
+		}
+	}
+	panic(err)
+}
+
+// ClassifyError 默认的错误分类
+func ClassifyError(err error) string {
+	switch {
+	case errors.Is(err, orm.ErrQueryTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, driver.ErrBadConn):
+		return "bad_conn"
+	default:
+		return "other"
+	}
 }
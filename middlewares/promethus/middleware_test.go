@@ -0,0 +1,117 @@
+package promethus
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+	"web/orm"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	builder := MiddlewareBuilder{
+		Namespace:  "test",
+		Name:       "query",
+		Registerer: reg,
+		Buckets:    []float64{0.001, 0.1},
+	}
+	// 重复构造不会 panic，而且共用同一组指标
+	_ = builder.Build()
+	mdl := builder.Build()
+
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(mdl))
+	require.NoError(t, err)
+	require.NoError(t, builder.RegisterDBStats(mockDB, "test"))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `user` SET `name`=? WHERE `id` = ?;")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `user` SET `name`=? WHERE `id` = ?;")).
+		WillReturnError(context.DeadlineExceeded)
+	for i := 0; i < 2; i++ {
+		_ = orm.NewUpdater[User](db).Set(orm.Assign("Name", "Tom")).
+			Where(orm.C("Id").Eq(1)).Exec(context.Background())
+	}
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	got := make(map[string]*dto.MetricFamily, len(families))
+	for _, f := range families {
+		got[f.GetName()] = f
+	}
+
+	// 响应时间换成了秒为单位的直方图，不能沿用原来毫秒 Summary 的名字
+	assert.NotContains(t, got, "test_query")
+	hist := got["test_query_duration_seconds"].GetMetric()[0].GetHistogram()
+	assert.Equal(t, uint64(2), hist.GetSampleCount())
+	assert.Len(t, hist.GetBucket(), 2)
+	// 秒为单位，sqlmock 很快，不会是 0 毫秒那样全部丢失精度
+	assert.Greater(t, hist.GetSampleSum(), float64(0))
+
+	errMetric := got["test_query_errors_total"].GetMetric()[0]
+	assert.Equal(t, float64(1), errMetric.GetCounter().GetValue())
+	assert.Equal(t, map[string]string{"type": "UPDATE", "table": "user", "class": "timeout"}, labels(errMetric))
+
+	assert.Equal(t, float64(0), got["test_query_in_flight"].GetMetric()[0].GetGauge().GetValue())
+	assert.Contains(t, got, "test_db_open_connections")
+	assert.Equal(t, map[string]string{"db": "test"}, labels(got["test_db_open_connections"].GetMetric()[0]))
+}
+
+func TestMiddlewareBuilder_Panic(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	mdl := MiddlewareBuilder{Name: "query", Registerer: reg}.Build()
+	handler := mdl(func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+		panic("mock panic")
+	})
+	assert.Panics(t, func() {
+		handler(context.Background(), &orm.QueryContext{Type: "SELECT"})
+	})
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() == "query_in_flight" {
+			// panic 之后正在执行的语句数量要减回去
+			assert.Equal(t, float64(0), f.GetMetric()[0].GetGauge().GetValue())
+			return
+		}
+	}
+	t.Fatal("没有 in_flight 指标")
+}
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want string
+	}{
+		{err: context.DeadlineExceeded, want: "timeout"},
+		{err: context.Canceled, want: "canceled"},
+		{err: errors.New("mock error"), want: "other"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) {
+			assert.Equal(t, tc.want, ClassifyError(tc.err))
+		})
+	}
+}
+
+func labels(m *dto.Metric) map[string]string {
+	res := make(map[string]string, len(m.GetLabel()))
+	for _, l := range m.GetLabel() {
+		res[l.GetName()] = l.GetValue()
+	}
+	return res
+}
+
+type User struct {
+	Id   int64
+	Name string
+}
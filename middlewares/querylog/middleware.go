@@ -2,21 +2,40 @@ package querylog
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf8"
 	"web/orm"
 )
 
+// MiddlewareBuilder 查询日志
+// 默认在语句执行之后通过 slog 输出一条记录，带着耗时、影响行数、错误和调用位置，
+// 不再在执行之前用 log 包输出。需要在执行之前拿到语句的可以用 LogFunc
 type MiddlewareBuilder struct {
-	// 允许用户使用自己的log输出方式
+	// 允许用户使用自己的log输出方式，设置了之后会在执行之前输出每一条语句
 	logFunc func(query string, args []any)
+
+	logger *slog.Logger
+	// threshold 执行时间超过它的语句才会输出，0 表示输出所有的语句
+	threshold time.Duration
+	// maxArgLen 字符串和 []byte 参数最多输出多少个字节，0 表示不截断
+	maxArgLen int
+	// redact 为 true 的时候不输出参数的值
+	redact bool
+	// interpolate 为 true 的时候额外输出拼接了参数的 SQL
+	interpolate bool
 }
 
+// NewMiddlewareBuilder 默认的输出和以前不一样：以前在执行之前用 log.Printf 输出 SQL 和参数，
+// 现在在执行之后通过 slog.Default() 输出一条结构化的记录。
+// 还想在执行之前输出的话用 LogFunc
 func NewMiddlewareBuilder() *MiddlewareBuilder {
-	return &MiddlewareBuilder{
-		logFunc: func(query string, args []any) {
-			log.Printf("SQL:query: %s args: %v \n", query, args)
-		},
-	}
+	return &MiddlewareBuilder{}
 }
 
 func (m *MiddlewareBuilder) LogFunc(fn func(query string, args []any)) *MiddlewareBuilder {
@@ -24,21 +43,154 @@ func (m *MiddlewareBuilder) LogFunc(fn func(query string, args []any)) *Middlewa
 	return m
 }
 
+// Logger 使用 slog 输出，默认是 slog.Default()
+func (m *MiddlewareBuilder) Logger(logger *slog.Logger) *MiddlewareBuilder {
+	m.logger = logger
+	return m
+}
+
+// SlowThreshold 只输出执行时间超过 threshold 的慢查询
+func (m *MiddlewareBuilder) SlowThreshold(threshold time.Duration) *MiddlewareBuilder {
+	m.threshold = threshold
+	return m
+}
+
+// MaxArgLen 截断过长的参数，避免大字段把日志撑爆
+func (m *MiddlewareBuilder) MaxArgLen(n int) *MiddlewareBuilder {
+	m.maxArgLen = n
+	return m
+}
+
+// RedactArgs 不输出参数的值，只输出类型，用于参数里面有敏感数据的场景
+func (m *MiddlewareBuilder) RedactArgs() *MiddlewareBuilder {
+	m.redact = true
+	return m
+}
+
+// Interpolate 额外输出拼接了参数的 SQL，方便复制出来直接执行，参数不会被截断。
+// 和 RedactArgs 一起使用的时候不会输出
+func (m *MiddlewareBuilder) Interpolate() *MiddlewareBuilder {
+	m.interpolate = true
+	return m
+}
+
 func (m MiddlewareBuilder) Build() orm.Middleware {
+	logger := m.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
 	return func(next orm.Handler) orm.Handler {
 		return func(ctx context.Context, queryCtx *orm.QueryContext) *orm.QueryResult {
-			q, err := queryCtx.Builder.Build()
+			q, err := queryCtx.Query()
 			if err != nil {
-				log.Println("orm: 构造SQL出错", err)
+				logger.LogAttrs(ctx, slog.LevelError, "orm: build query",
+					slog.String("type", queryCtx.Type),
+					slog.String("error", err.Error()))
 				return &orm.QueryResult{
 					Err: err,
 				}
 			}
+			if m.logFunc != nil {
+				m.logFunc(q.SQL, q.Args)
+			}
 
-			m.logFunc(q.SQL, q.Args)
-
+			start := time.Now()
 			res := next(ctx, queryCtx)
+			elapsed := time.Since(start)
+			if elapsed < m.threshold {
+				return res
+			}
+
+			attrs := make([]slog.Attr, 0, 8)
+			attrs = append(attrs,
+				slog.String("type", queryCtx.Type),
+				slog.String("sql", q.SQL),
+				slog.Any("args", m.formatArgs(q.Args)),
+				slog.Duration("elapsed", elapsed))
+			if m.interpolate && !m.redact {
+				if stmt, err := q.Interpolate(); err == nil {
+					attrs = append(attrs, slog.String("interpolated", stmt))
+				}
+			}
+			if queryCtx.Model != nil {
+				attrs = append(attrs, slog.String("table", queryCtx.Model.TableName))
+			}
+			if r, ok := res.Result.(interface{ RowsAffected() (int64, error) }); ok && res.Err == nil {
+				if affected, err := r.RowsAffected(); err == nil {
+					attrs = append(attrs, slog.Int64("rows_affected", affected))
+				}
+			}
+			if caller := callerOf(); caller != "" {
+				attrs = append(attrs, slog.String("caller", caller))
+			}
+
+			level, msg := slog.LevelInfo, "orm: query"
+			if m.threshold > 0 {
+				level, msg = slog.LevelWarn, "orm: slow query"
+			}
+			if res.Err != nil && !errors.Is(res.Err, orm.ErrNoRows) {
+				level = slog.LevelError
+				attrs = append(attrs, slog.String("error", res.Err.Error()))
+			}
+			logger.LogAttrs(ctx, level, msg, attrs...)
 			return res
 		}
 	}
 }
+
+// formatArgs 按照配置截断或者隐藏参数
+func (m MiddlewareBuilder) formatArgs(args []any) []any {
+	if !m.redact && m.maxArgLen <= 0 {
+		return args
+	}
+	res := make([]any, 0, len(args))
+	for _, arg := range args {
+		if m.redact {
+			res = append(res, fmt.Sprintf("<%T>", arg))
+			continue
+		}
+		switch v := arg.(type) {
+		case string:
+			res = append(res, truncate(v, m.maxArgLen))
+		case []byte:
+			res = append(res, truncate(string(v), m.maxArgLen))
+		default:
+			res = append(res, arg)
+		}
+	}
+	return res
+}
+
+// truncate 按照字节截断，截断的位置落在多字节字符中间的时候往前退到字符的开头，
+// 避免日志里面出现半个字符
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n
+	for i := 0; i < utf8.UTFMax-1 && cut > 0 && !utf8.RuneStart(s[cut]); i++ {
+		cut--
+	}
+	return fmt.Sprintf("%s...(%d bytes)", s[:cut], len(s))
+}
+
+// ormPkg orm 本身的包路径，输出调用位置的时候要跳过 orm 内部的调用栈
+var ormPkg = reflect.TypeOf(orm.DB{}).PkgPath()
+
+// callerOf 找到第一个不在 orm 内部的调用者，测试文件除外
+func callerOf() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		inOrm := strings.HasPrefix(frame.Function, ormPkg+".") ||
+			strings.HasPrefix(frame.Function, ormPkg+"/middlewares/")
+		if frame.Function != "" && (!inOrm || strings.HasSuffix(frame.File, "_test.go")) {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
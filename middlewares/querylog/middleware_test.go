@@ -0,0 +1,269 @@
+package querylog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+	"web/orm"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name    string
+		builder *MiddlewareBuilder
+		mockErr error
+		// wantLog 为 nil 表示不应该输出日志
+		wantLog map[string]any
+	}{
+		{
+			name:    "all",
+			builder: NewMiddlewareBuilder().MaxArgLen(3),
+			wantLog: map[string]any{
+				"level":         "INFO",
+				"msg":           "orm: query",
+				"type":          "UPDATE",
+				"sql":           "UPDATE `user` SET `name`=? WHERE `id` = ?;",
+				"args":          []any{"Tom...(8 bytes)", float64(1)},
+				"table":         "user",
+				"rows_affected": float64(1),
+			},
+		},
+		{
+			name:    "redact",
+			builder: NewMiddlewareBuilder().RedactArgs(),
+			wantLog: map[string]any{
+				"level":         "INFO",
+				"msg":           "orm: query",
+				"type":          "UPDATE",
+				"sql":           "UPDATE `user` SET `name`=? WHERE `id` = ?;",
+				"args":          []any{"<string>", "<int>"},
+				"table":         "user",
+				"rows_affected": float64(1),
+			},
+		},
+		{
+			name:    "error",
+			builder: NewMiddlewareBuilder(),
+			mockErr: errors.New("mock error"),
+			wantLog: map[string]any{
+				"level": "ERROR",
+				"msg":   "orm: query",
+				"type":  "UPDATE",
+				"sql":   "UPDATE `user` SET `name`=? WHERE `id` = ?;",
+				"args":  []any{"TomTomTo", float64(1)},
+				"table": "user",
+				"error": "mock error",
+			},
+		},
+		{
+			name:    "interpolate",
+			builder: NewMiddlewareBuilder().Interpolate(),
+			wantLog: map[string]any{
+				"level":         "INFO",
+				"msg":           "orm: query",
+				"type":          "UPDATE",
+				"sql":           "UPDATE `user` SET `name`=? WHERE `id` = ?;",
+				"args":          []any{"TomTomTo", float64(1)},
+				"interpolated":  "UPDATE `user` SET `name`='TomTomTo' WHERE `id` = 1;",
+				"table":         "user",
+				"rows_affected": float64(1),
+			},
+		},
+		{
+			name:    "fast query",
+			builder: NewMiddlewareBuilder().SlowThreshold(time.Minute),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			mdl := tc.builder.Logger(slog.New(slog.NewJSONHandler(buf, nil))).Build()
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer mockDB.Close()
+			db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(mdl))
+			require.NoError(t, err)
+
+			// 中间件里面构造过一次，执行的语句也不能重复
+			exp := mock.ExpectExec(regexp.QuoteMeta("UPDATE `user` SET `name`=? WHERE `id` = ?;"))
+			if tc.mockErr != nil {
+				exp.WillReturnError(tc.mockErr)
+			} else {
+				exp.WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			res := orm.NewUpdater[User](db).Set(orm.Assign("Name", "TomTomTo")).
+				Where(orm.C("Id").Eq(1)).Exec(context.Background())
+			assert.Equal(t, tc.mockErr, res.Err())
+
+			if tc.wantLog == nil {
+				assert.Empty(t, buf.String())
+				return
+			}
+			var got map[string]any
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+			assert.True(t, strings.Contains(got["caller"].(string), "middleware_test.go"), got["caller"])
+			assert.NotEmpty(t, got["elapsed"])
+			for _, key := range []string{"time", "caller", "elapsed"} {
+				delete(got, key)
+			}
+			assert.Equal(t, tc.wantLog, got)
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Output(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	// 默认不再通过 log 包输出
+	stdBuf := &bytes.Buffer{}
+	log.SetOutput(stdBuf)
+	defer log.SetOutput(os.Stderr)
+
+	buf := &bytes.Buffer{}
+	var logged []string
+	mdl := NewMiddlewareBuilder().Logger(slog.New(slog.NewJSONHandler(buf, nil))).
+		LogFunc(func(query string, args []any) {
+			// 在执行之前输出，这时候语句还没有发出去
+			assert.Error(t, mock.ExpectationsWereMet())
+			logged = append(logged, query)
+		}).Build()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(mdl))
+	require.NoError(t, err)
+
+	// 构造出错的时候也通过 logger 输出
+	res := orm.NewUpdater[User](db).Set(orm.Assign("Invalid", 1)).
+		Where(orm.C("Id").Eq(1)).Exec(context.Background())
+	require.Error(t, res.Err())
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "ERROR", got["level"])
+	assert.Equal(t, "orm: build query", got["msg"])
+	assert.Equal(t, "UPDATE", got["type"])
+	assert.Equal(t, res.Err().Error(), got["error"])
+	assert.Empty(t, logged)
+
+	buf.Reset()
+	mock.ExpectExec("UPDATE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	res = orm.NewUpdater[User](db).Set(orm.Assign("Name", "Tom")).
+		Where(orm.C("Id").Eq(1)).Exec(context.Background())
+	require.NoError(t, res.Err())
+	assert.Equal(t, []string{"UPDATE `user` SET `name`=? WHERE `id` = ?;"}, logged)
+	assert.NotEmpty(t, buf.String())
+	assert.Empty(t, stdBuf.String())
+}
+
+// TestMiddlewareBuilder_Default 默认不再在执行之前用 log.Printf 输出，
+// 而是在执行之后通过 slog.Default() 输出
+func TestMiddlewareBuilder_Default(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	// 放在查询日志里面一层，执行的时候还没有任何输出
+	before := func(next orm.Handler) orm.Handler {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			assert.Empty(t, buf.String())
+			return next(ctx, qc)
+		}
+	}
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(NewMiddlewareBuilder().Build(), before))
+	require.NoError(t, err)
+
+	mock.ExpectExec("UPDATE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	res := orm.NewUpdater[User](db).Set(orm.Assign("Name", "Tom")).
+		Where(orm.C("Id").Eq(1)).Exec(context.Background())
+	require.NoError(t, res.Err())
+	assert.Contains(t, buf.String(), "INFO orm: query")
+	assert.NotContains(t, buf.String(), "SQL:query:")
+}
+
+// TestMiddlewareBuilder_GetMulti GetMulti 也要经过中间件
+func TestMiddlewareBuilder_GetMulti(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	buf := &bytes.Buffer{}
+	mdl := NewMiddlewareBuilder().Logger(slog.New(slog.NewJSONHandler(buf, nil))).Build()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(mdl))
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Tom").AddRow(2, "Jerry")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `user` WHERE `id` > ?;")).WillReturnRows(rows)
+	users, err := orm.NewSelector[User](db).Where(orm.C("Id").Gt(0)).GetMulti(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, users, 2)
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "INFO", got["level"])
+	assert.Equal(t, "SELECT", got["type"])
+	assert.Equal(t, "SELECT * FROM `user` WHERE `id` > ?;", got["sql"])
+	assert.Equal(t, "user", got["table"])
+}
+
+func TestTruncate(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{
+			name: "short",
+			s:    "Tom",
+			n:    3,
+			want: "Tom",
+		},
+		{
+			name: "ascii",
+			s:    "TomJerry",
+			n:    3,
+			want: "Tom...(8 bytes)",
+		},
+		{
+			// 每个汉字 3 个字节，不能切成半个字符
+			name: "multi-byte",
+			s:    "你好世界",
+			n:    4,
+			want: "你...(12 bytes)",
+		},
+		{
+			name: "rune boundary",
+			s:    "你好世界",
+			n:    6,
+			want: "你好...(12 bytes)",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := truncate(tc.s, tc.n)
+			assert.Equal(t, tc.want, got)
+			assert.True(t, utf8.ValidString(got))
+		})
+	}
+}
+
+type User struct {
+	Id   int64
+	Name string
+}
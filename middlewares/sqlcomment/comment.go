@@ -0,0 +1,54 @@
+package sqlcomment
+
+import (
+	"sort"
+	"strings"
+)
+
+// Append 把键值对以注释的形式加到 SQL 末尾，分号之前。
+// 键值对按照键排序，值用单引号包裹，键和值都会转义
+func Append(query string, kvs map[string]string) string {
+	if len(kvs) == 0 {
+		return query
+	}
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(" /* ")
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(escape(k))
+		sb.WriteString("='")
+		sb.WriteString(escape(kvs[k]))
+		sb.WriteByte('\'')
+	}
+	sb.WriteString(" */")
+
+	trimmed := strings.TrimRight(query, " \t\n;")
+	return trimmed + sb.String() + query[len(trimmed):]
+}
+
+// escape 百分号编码，只保留少数安全的字符。
+// 引号、反斜杠和 * 会被编码，所以值不可能提前结束字符串或者注释；
+// ? 也会被编码，避免驱动在拼接参数的时候把它当作占位符
+func escape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			strings.IndexByte("-_.~/:@", c) >= 0 {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte("0123456789ABCDEF"[c>>4])
+		sb.WriteByte("0123456789ABCDEF"[c&15])
+	}
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package sqlcomment
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/propagation"
+	"web/orm"
+)
+
+type tagsKey struct{}
+
+// WithTags 在 context 里面加上要写进注释的键值对，例如 WithTags(ctx, "route", "/users")
+// 会保留外层设置的键值对，同名的会被覆盖
+func WithTags(ctx context.Context, kvs ...string) context.Context {
+	old, _ := ctx.Value(tagsKey{}).(map[string]string)
+	tags := make(map[string]string, len(old)+len(kvs)/2)
+	for k, v := range old {
+		tags[k] = v
+	}
+	for i := 0; i+1 < len(kvs); i += 2 {
+		tags[kvs[i]] = kvs[i+1]
+	}
+	return context.WithValue(ctx, tagsKey{}, tags)
+}
+
+// MiddlewareBuilder 按照 sqlcommenter 的格式在每一条语句后面加上注释，
+// 例如 SELECT * FROM `user` /* app='x',route='/users' */;
+// 这样在 processlist 和慢查询日志里面就能知道语句是哪里发出来的。
+// 同样的键值对生成的注释是一样的，不会导致语句缓存失效，
+// 所以不要放请求 ID 这一类每次都不一样的值
+type MiddlewareBuilder struct {
+	tags       map[string]string
+	extractors []func(ctx context.Context) map[string]string
+	propagator propagation.TextMapPropagator
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		tags: map[string]string{},
+	}
+}
+
+// Tag 固定的键值对，例如应用名
+func (m *MiddlewareBuilder) Tag(key, value string) *MiddlewareBuilder {
+	m.tags[key] = value
+	return m
+}
+
+// Extractor 从 context 里面取出键值对，例如 web 框架放进去的路由
+func (m *MiddlewareBuilder) Extractor(fn func(ctx context.Context) map[string]string) *MiddlewareBuilder {
+	m.extractors = append(m.extractors, fn)
+	return m
+}
+
+// Propagator 把 trace context 也写进注释，例如 propagation.TraceContext{}
+// traceparent 每个请求都不一样，开启之后每一条语句都是不同的 SQL
+func (m *MiddlewareBuilder) Propagator(p propagation.TextMapPropagator) *MiddlewareBuilder {
+	m.propagator = p
+	return m
+}
+
+func (m MiddlewareBuilder) Build() orm.Middleware {
+	return func(next orm.Handler) orm.Handler {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			q, err := qc.Query()
+			if err != nil {
+				return &orm.QueryResult{Err: err}
+			}
+			q.SQL = Append(q.SQL, m.collect(ctx))
+			return next(ctx, qc)
+		}
+	}
+}
+
+// collect 优先级从低到高：固定的、Extractor 取出来的、WithTags 设置的、trace context
+func (m MiddlewareBuilder) collect(ctx context.Context) map[string]string {
+	res := make(map[string]string, len(m.tags))
+	for k, v := range m.tags {
+		res[k] = v
+	}
+	for _, fn := range m.extractors {
+		for k, v := range fn(ctx) {
+			res[k] = v
+		}
+	}
+	tags, _ := ctx.Value(tagsKey{}).(map[string]string)
+	for k, v := range tags {
+		res[k] = v
+	}
+	if m.propagator != nil {
+		m.propagator.Inject(ctx, propagation.MapCarrier(res))
+	}
+	return res
+}
@@ -0,0 +1,85 @@
+package sqlcomment
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"regexp"
+	"testing"
+	"web/orm"
+)
+
+func TestAppend(t *testing.T) {
+	testCases := []struct {
+		name  string
+		query string
+		kvs   map[string]string
+		want  string
+	}{
+		{
+			name:  "empty",
+			query: "SELECT * FROM `user`;",
+			want:  "SELECT * FROM `user`;",
+		},
+		{
+			name:  "sorted",
+			query: "SELECT * FROM `user`;",
+			kvs:   map[string]string{"route": "/users", "app": "x"},
+			want:  "SELECT * FROM `user` /* app='x',route='/users' */;",
+		},
+		{
+			name:  "no semicolon",
+			query: "SELECT 1",
+			kvs:   map[string]string{"app": "x"},
+			want:  "SELECT 1 /* app='x' */",
+		},
+		{
+			name:  "escape",
+			query: "SELECT 1;",
+			kvs:   map[string]string{"a'b": "x' */ DROP TABLE `user`; -- ?\\"},
+			want:  "SELECT 1 /* a%27b='x%27%20%2A/%20DROP%20TABLE%20%60user%60%3B%20--%20%3F%5C' */;",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Append(tc.query, tc.kvs))
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	mdl := NewMiddlewareBuilder().Tag("app", "x").Tag("route", "unknown").
+		Extractor(func(ctx context.Context) map[string]string {
+			return map[string]string{"controller": "user"}
+		}).
+		Propagator(propagation.TraceContext{}).Build()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(mdl))
+	require.NoError(t, err)
+
+	traceID, _ := trace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	spanID, _ := trace.SpanIDFromHex("0102030405060708")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled,
+	}))
+	ctx = WithTags(WithTags(ctx, "route", "/users"), "user", "1")
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `user` SET `name`=? WHERE `id` = ? /* app='x',controller='user',route='/users',"+
+		"traceparent='00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01',user='1' */;")).
+		WithArgs("Tom", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	res := orm.NewUpdater[User](db).Set(orm.Assign("Name", "Tom")).
+		Where(orm.C("Id").Eq(1)).Exec(ctx)
+	assert.NoError(t, res.Err())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type User struct {
+	Id   int64
+	Name string
+}
@@ -0,0 +1,60 @@
+package timeout
+
+import (
+	"context"
+	"time"
+	"web/orm"
+)
+
+// MiddlewareBuilder 给每一条语句加上超时时间，超时之后返回 orm.ErrQueryTimeout。
+// context 本身的截止时间更早的话以 context 的为准
+type MiddlewareBuilder struct {
+	timeout      time.Duration
+	typeTimeouts map[string]time.Duration
+	serverHint   bool
+}
+
+// NewMiddlewareBuilder timeout 是默认的超时时间，0 表示默认不限制
+func NewMiddlewareBuilder(timeout time.Duration) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		timeout:      timeout,
+		typeTimeouts: map[string]time.Duration{},
+	}
+}
+
+// TypeTimeout 单独设置某一种语句的超时时间，例如 TypeTimeout("SELECT", time.Second)
+func (m *MiddlewareBuilder) TypeTimeout(typ string, d time.Duration) *MiddlewareBuilder {
+	m.typeTimeouts[typ] = d
+	return m
+}
+
+// ServerHint 给 SELECT 加上方言支持的执行时间提示，例如 MySQL 的 MAX_EXECUTION_TIME，
+// 让数据库那边也能及时停下来。SQLite 这样不支持的方言不会添加，
+// 已经用 Selector.Timeout 设置过的语句也不会重复添加
+func (m *MiddlewareBuilder) ServerHint() *MiddlewareBuilder {
+	m.serverHint = true
+	return m
+}
+
+func (m MiddlewareBuilder) Build() orm.Middleware {
+	return func(next orm.Handler) orm.Handler {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			d, ok := m.typeTimeouts[qc.Type]
+			if !ok {
+				d = m.timeout
+			}
+			if d <= 0 {
+				return next(ctx, qc)
+			}
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			if m.serverHint && qc.Type == "SELECT" {
+				deadline, _ := ctx.Deadline()
+				if err := qc.AddExecutionTimeHint(time.Until(deadline)); err != nil {
+					return &orm.QueryResult{Err: err}
+				}
+			}
+			return next(ctx, qc)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package timeout
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+	"time"
+	"web/orm"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name     string
+		builder  *MiddlewareBuilder
+		opts     []orm.DBOption
+		selector func(db *orm.DB) *orm.Selector[User]
+		wantSQL  string
+		delay    time.Duration
+		wantErr  error
+	}{
+		{
+			name:    "no timeout",
+			builder: NewMiddlewareBuilder(0).ServerHint(),
+			wantSQL: "SELECT * FROM `user`;",
+		},
+		{
+			name:    "hint",
+			builder: NewMiddlewareBuilder(time.Minute).ServerHint(),
+			wantSQL: "SELECT /*+ MAX_EXECUTION_TIME(",
+		},
+		{
+			// SQLite 不支持执行时间提示
+			name:    "sqlite no hint",
+			builder: NewMiddlewareBuilder(time.Minute).ServerHint(),
+			opts:    []orm.DBOption{orm.DBWithDialect(orm.DialectSQLite)},
+			wantSQL: "SELECT * FROM `user`;",
+		},
+		{
+			name:    "selector timeout",
+			builder: NewMiddlewareBuilder(time.Minute).ServerHint(),
+			selector: func(db *orm.DB) *orm.Selector[User] {
+				return orm.NewSelector[User](db).Timeout(time.Second)
+			},
+			wantSQL: "SELECT /*+ MAX_EXECUTION_TIME(1000) */ * FROM `user`;",
+		},
+		{
+			name:    "type timeout",
+			builder: NewMiddlewareBuilder(time.Minute).TypeTimeout("SELECT", 10*time.Millisecond),
+			wantSQL: "SELECT * FROM `user`;",
+			delay:   time.Second,
+			wantErr: orm.ErrQueryTimeout,
+		},
+		{
+			name:    "type no timeout",
+			builder: NewMiddlewareBuilder(10*time.Millisecond).TypeTimeout("SELECT", 0),
+			wantSQL: "SELECT * FROM `user`;",
+			delay:   50 * time.Millisecond,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer mockDB.Close()
+			db, err := orm.OpenDB(mockDB, append(tc.opts, orm.DBWithMiddleware(tc.builder.Build()))...)
+			require.NoError(t, err)
+
+			mock.ExpectQuery("^" + regexp.QuoteMeta(tc.wantSQL)).WillDelayFor(tc.delay).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			s := orm.NewSelector[User](db)
+			if tc.selector != nil {
+				s = tc.selector(db)
+			}
+			_, err = s.Get(context.Background())
+			assert.ErrorIs(t, err, tc.wantErr)
+			if tc.wantErr == nil {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+type User struct {
+	Id int64
+}
@@ -1,19 +1,39 @@
 package model
 
 import (
+	"database/sql"
 	"errors"
 	"reflect"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 	"web/orm/internal/errs"
 )
 
 const (
 	// 在标签里 column专门用于重命名列名
 	tagKeyColumn = "column"
+	// tagKeySoftDelete 标记软删除字段，例如 orm:"soft_delete"
+	tagKeySoftDelete = "soft_delete"
+	// tagKeyVersion 标记乐观锁的版本号字段，例如 orm:"version"
+	tagKeyVersion = "version"
+	// 自动维护的创建时间和更新时间，整数类型默认是秒，
+	// 可以用 orm:"auto_create_time=milli" 指定为毫秒
+	tagKeyAutoCreateTime = "auto_create_time"
+	tagKeyAutoUpdateTime = "auto_update_time"
+	autoTimeMilli        = "milli"
 )
 
+// flagTags 不需要值的标签，解析之后值是 "true"
+var flagTags = map[string]bool{
+	tagKeySoftDelete: true,
+	tagKeyVersion:    true,
+
+	tagKeyAutoCreateTime: true,
+	tagKeyAutoUpdateTime: true,
+}
+
 var (
 	matchFirstCap            = regexp.MustCompile("(.)([A-Z][a-z]+)")
 	matchAllCap              = regexp.MustCompile("([a-z0-9])([A-Z])")
@@ -24,6 +44,10 @@ var (
 type Registry interface {
 	Get(val any) (*Model, error)
 	Register(entity any, opts ...Option) (*Model, error)
+	// RegisterModel 直接登记预先构造好的元数据，例如代码生成的元数据，
+	// 这样就不需要在运行时通过反射解析结构体。
+	// 登记之前会和 Register 一样校验软删除、版本号和自动时间字段的类型
+	RegisterModel(entity any, m *Model) error
 }
 
 type TableName interface {
@@ -38,6 +62,18 @@ type Model struct {
 	FieldMap map[string]*Field
 	// 列
 	ColumnMap map[string]*Field
+
+	// 关联关系，关联字段不会出现在 Fields 里面
+	Relations   []*Relation
+	RelationMap map[string]*Relation
+
+	// SoftDelete 软删除字段，为 nil 说明模型不支持软删除
+	SoftDelete *Field
+	// Version 乐观锁的版本号字段，为 nil 说明模型不使用乐观锁
+	Version *Field
+	// 自动维护的创建时间和更新时间字段
+	AutoCreateTime *Field
+	AutoUpdateTime *Field
 }
 
 type Option func(*Model) error
@@ -52,6 +88,20 @@ type Field struct {
 
 	// 偏移量
 	Offset uintptr
+
+	// Milli 自动维护的时间字段是整数的时候，true 表示毫秒，否则是秒
+	Milli bool
+}
+
+// FieldTag 从一个列字段的标签里面解析出来的信息，反射解析和代码生成共用
+type FieldTag struct {
+	ColName        string
+	SoftDelete     bool
+	Version        bool
+	AutoCreateTime bool
+	AutoUpdateTime bool
+	// Milli 自动维护的时间字段使用毫秒
+	Milli bool
 }
 
 // registry 元数据注册中心
@@ -82,7 +132,9 @@ func WithColumnName(field, colName string) Option {
 		if !ok {
 			return errs.NewErrUnknownField(field)
 		}
+		delete(r.ColumnMap, fd.ColName)
 		fd.ColName = colName
+		r.ColumnMap[colName] = fd
 		return nil
 	}
 }
@@ -114,6 +166,20 @@ func (r *registry) Get(val any) (*Model, error) {
 	return m, nil
 }
 
+func (r *registry) RegisterModel(entity any, m *Model) error {
+	typ := reflect.TypeOf(entity)
+	if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return errs.ErrPointerOnly
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.models[typ] = m
+	return nil
+}
+
 func (r *registry) Register(entity any, opts ...Option) (*Model, error) {
 	typ := reflect.TypeOf(entity)
 	if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
@@ -124,28 +190,50 @@ func (r *registry) Register(entity any, opts ...Option) (*Model, error) {
 	fieldMap := make(map[string]*Field, numField)
 	columnMap := make(map[string]*Field, numField)
 	fields := make([]*Field, 0, numField)
+	var relations []*Relation
+	relationMap := make(map[string]*Relation, 2)
+	var softDelete, version, autoCreateTime, autoUpdateTime *Field
 	for i := 0; i < numField; i++ {
 		f := typ.Field(i)
 		// pair中包含了结构体中目前字段解析出来的tag
-		pair, err := r.parseTag(f.Tag)
+		pair, err := ParseTag(f.Tag)
 		if err != nil {
 			return nil, err
 		}
-		colName := pair[tagKeyColumn]
-		// 如果标签为空，我们就帮用户进行处理
-		if colName == "" {
-			colName = UnderscoreCase(f.Name)
+		// 关联字段不是列
+		if _, ok := pair[tagKeyRel]; ok {
+			rel, err := parseRelation(typ.Name(), f, pair)
+			if err != nil {
+				return nil, err
+			}
+			relations = append(relations, rel)
+			relationMap[f.Name] = rel
+			continue
 		}
+		ft := ParseFieldTag(f.Name, pair)
 		fd := &Field{
-			ColName: colName,
+			ColName: ft.ColName,
 			GoName:  f.Name,
 			Type:    f.Type,
 			Offset:  f.Offset,
+			Milli:   ft.Milli,
+		}
+		if ft.SoftDelete {
+			softDelete = fd
+		}
+		if ft.Version {
+			version = fd
+		}
+		if ft.AutoCreateTime {
+			autoCreateTime = fd
+		}
+		if ft.AutoUpdateTime {
+			autoUpdateTime = fd
 		}
 		fields = append(fields, fd)
 		fieldMap[f.Name] = fd
 		// column就是用户自定义的字段名称
-		columnMap[colName] = fd
+		columnMap[ft.ColName] = fd
 	}
 
 	var tableName string
@@ -161,17 +249,31 @@ func (r *registry) Register(entity any, opts ...Option) (*Model, error) {
 		Fields:    fields,
 		FieldMap:  fieldMap,
 		ColumnMap: columnMap,
+
+		Relations:   relations,
+		RelationMap: relationMap,
+
+		SoftDelete: softDelete,
+		Version:    version,
+
+		AutoCreateTime: autoCreateTime,
+		AutoUpdateTime: autoUpdateTime,
+	}
+	if err := res.Validate(); err != nil {
+		return nil, err
 	}
 
 	for _, opt := range opts {
-		opt(res)
+		if err := opt(res); err != nil {
+			return nil, err
+		}
 	}
 	return res, nil
 }
 
-// parseTag 解析标签: 目的是为了可以拿到用户自定义的列名
+// ParseTag 解析标签: 目的是为了可以拿到用户自定义的列名
 // 我希望用户是 “orm:"column=id, xxx=xx" 这样子定义列名
-func (r *registry) parseTag(tag reflect.StructTag) (map[string]string, error) {
+func ParseTag(tag reflect.StructTag) (map[string]string, error) {
 	ormTag, ok := tag.Lookup("orm")
 	if !ok {
 		return map[string]string{}, nil
@@ -180,6 +282,10 @@ func (r *registry) parseTag(tag reflect.StructTag) (map[string]string, error) {
 	res := make(map[string]string, len(pairs))
 	for _, pair := range pairs {
 		segs := strings.Split(pair, "=")
+		if len(segs) == 1 && flagTags[pair] {
+			res[pair] = "true"
+			continue
+		}
 		if len(segs) != 2 {
 			return nil, errs.NewErrInvalidTagContent(pair)
 		}
@@ -190,6 +296,73 @@ func (r *registry) parseTag(tag reflect.StructTag) (map[string]string, error) {
 	return res, nil
 }
 
+// ParseFieldTag 从解析好的标签里面拿到列字段的信息，没有指定列名的时候使用下划线形式的字段名
+func ParseFieldTag(goName string, pair map[string]string) FieldTag {
+	res := FieldTag{ColName: pair[tagKeyColumn]}
+	// 如果标签为空，我们就帮用户进行处理
+	if res.ColName == "" {
+		res.ColName = UnderscoreCase(goName)
+	}
+	_, res.SoftDelete = pair[tagKeySoftDelete]
+	_, res.Version = pair[tagKeyVersion]
+	var unit string
+	if unit, res.AutoCreateTime = pair[tagKeyAutoCreateTime]; unit == autoTimeMilli {
+		res.Milli = true
+	}
+	if unit, res.AutoUpdateTime = pair[tagKeyAutoUpdateTime]; unit == autoTimeMilli {
+		res.Milli = true
+	}
+	return res
+}
+
+// Validate 校验软删除、版本号和自动时间字段的类型
+func (m *Model) Validate() error {
+	if fd := m.SoftDelete; fd != nil && !IsSoftDeleteType(fd.Type) {
+		return errs.NewErrInvalidSoftDelete(fd.GoName, fd.Type)
+	}
+	if fd := m.Version; fd != nil && !IsVersionType(fd.Type) {
+		return errs.NewErrInvalidVersion(fd.GoName, fd.Type)
+	}
+	for _, fd := range []*Field{m.AutoCreateTime, m.AutoUpdateTime} {
+		if fd != nil && !IsAutoTimeType(fd.Type) {
+			return errs.NewErrInvalidAutoTime(fd.GoName, fd.Type)
+		}
+	}
+	return nil
+}
+
+// IsSoftDeleteType 软删除字段支持 *time.Time、sql.NullTime 以及 bool 和整数这样的标记位
+// time.Time 没有 NULL，没删除的数据也不是 NULL，所以不支持
+func IsSoftDeleteType(typ reflect.Type) bool {
+	switch typ {
+	case reflect.TypeOf(&time.Time{}), reflect.TypeOf(sql.NullTime{}):
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsVersionType 版本号只能是整数
+func IsVersionType(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsAutoTimeType 自动维护的时间字段支持 time.Time 以及整数
+func IsAutoTimeType(typ reflect.Type) bool {
+	return typ == reflect.TypeOf(time.Time{}) || IsVersionType(typ)
+}
+
 // UnderscoreCase 将驼峰命名转换为下划线分隔的小写形式
 func UnderscoreCase(s string) string {
 	// 应用正则转换
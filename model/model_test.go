@@ -1,8 +1,13 @@
 package model
 
 import (
+	"database/sql"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
 	"testing"
+	"time"
+	"web/orm/internal/errs"
 )
 
 func TestUnderscoreCase(t *testing.T) {
@@ -34,3 +39,216 @@ func TestUnderscoreCase(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistry_Relation(t *testing.T) {
+	testCases := []struct {
+		name          string
+		entity        any
+		wantRelations []*Relation
+		wantErr       error
+	}{
+		{
+			name:   "has many and many to many",
+			entity: &relUser{},
+			wantRelations: []*Relation{
+				{
+					FieldName:  "Orders",
+					Type:       HasMany,
+					Target:     reflect.TypeOf(relOrder{}),
+					ForeignKey: "relUserId",
+					References: "Id",
+				},
+				{
+					FieldName:        "Roles",
+					Type:             ManyToMany,
+					Target:           reflect.TypeOf(relRole{}),
+					ForeignKey:       "relUserId",
+					References:       "Id",
+					JoinTable:        "user_role",
+					JoinForeignKey:   "rel_user_id",
+					JoinReferences:   "rel_role_id",
+					TargetReferences: "Id",
+				},
+			},
+		},
+		{
+			name:   "many to many target refs",
+			entity: &relCodeUser{},
+			wantRelations: []*Relation{
+				{
+					FieldName:        "Roles",
+					Type:             ManyToMany,
+					Target:           reflect.TypeOf(relRole{}),
+					ForeignKey:       "relCodeUserId",
+					References:       "Id",
+					JoinTable:        "rel_code_user_rel_role",
+					JoinForeignKey:   "rel_code_user_id",
+					JoinReferences:   "role_code",
+					TargetReferences: "Code",
+				},
+			},
+		},
+		{
+			name:   "belongs to",
+			entity: &relOrder{},
+			wantRelations: []*Relation{
+				{
+					FieldName:  "User",
+					Type:       BelongsTo,
+					Target:     reflect.TypeOf(relUser{}),
+					ForeignKey: "UserId",
+					References: "Id",
+				},
+			},
+		},
+		{
+			name: "has many not slice",
+			entity: &struct {
+				Orders *relOrder `orm:"rel=has_many"`
+			}{},
+			wantErr: errs.NewErrInvalidRelation("Orders", "必须是切片"),
+		},
+		{
+			name: "belongs to slice",
+			entity: &struct {
+				Users []*relUser `orm:"rel=belongs_to"`
+			}{},
+			wantErr: errs.NewErrInvalidRelation("Users", "不能是切片"),
+		},
+		{
+			name: "target refs not many to many",
+			entity: &struct {
+				Orders []*relOrder `orm:"rel=has_many,target_refs=Code"`
+			}{},
+			wantErr: errs.NewErrInvalidRelation("Orders", "只有多对多可以设置 target_refs"),
+		},
+		{
+			name: "unknown type",
+			entity: &struct {
+				Orders *relOrder `orm:"rel=has_some"`
+			}{},
+			wantErr: errs.NewErrInvalidRelation("Orders", "不支持的类型 has_some"),
+		},
+	}
+
+	r := NewRegistry()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := r.Register(tc.entity)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantRelations, m.Relations)
+			for _, rel := range tc.wantRelations {
+				// 关联字段不是列
+				_, ok := m.FieldMap[rel.FieldName]
+				assert.False(t, ok)
+			}
+		})
+	}
+}
+
+type relUser struct {
+	Id     int64
+	Orders []*relOrder `orm:"rel=has_many"`
+	Roles  []relRole   `orm:"rel=many_to_many,join_table=user_role"`
+}
+
+type relCodeUser struct {
+	Id    int64
+	Roles []relRole `orm:"rel=many_to_many,join_refs=role_code,target_refs=Code"`
+}
+
+type relOrder struct {
+	Id     int64
+	UserId int64
+	User   *relUser `orm:"rel=belongs_to"`
+}
+
+type relRole struct {
+	Id   int64
+	Code string
+}
+
+func TestWithColumnName(t *testing.T) {
+	type TestModel struct {
+		Id   int64
+		Name string
+	}
+	m, err := NewRegistry().Register(&TestModel{}, WithColumnName("Name", "nick"))
+	require.NoError(t, err)
+	assert.Equal(t, "nick", m.FieldMap["Name"].ColName)
+	assert.Equal(t, m.FieldMap["Name"], m.ColumnMap["nick"])
+	assert.NotContains(t, m.ColumnMap, "name")
+
+	_, err = NewRegistry().Register(&TestModel{}, WithColumnName("Age", "age"))
+	assert.Equal(t, errs.NewErrUnknownField("Age"), err)
+}
+
+func TestRegistry_SoftDelete(t *testing.T) {
+	testCases := []struct {
+		name    string
+		entity  any
+		wantErr error
+	}{
+		{
+			name: "time pointer",
+			entity: &struct {
+				DeletedAt *time.Time `orm:"soft_delete"`
+			}{},
+		},
+		{
+			name: "null time",
+			entity: &struct {
+				DeletedAt sql.NullTime `orm:"soft_delete"`
+			}{},
+		},
+		{
+			name: "int flag",
+			entity: &struct {
+				Deleted uint8 `orm:"soft_delete"`
+			}{},
+		},
+		{
+			// 没有删除的数据也不是 NULL，没有办法区分
+			name: "time",
+			entity: &struct {
+				DeletedAt time.Time `orm:"soft_delete"`
+			}{},
+			wantErr: errs.NewErrInvalidSoftDelete("DeletedAt", reflect.TypeOf(time.Time{})),
+		},
+		{
+			name: "string",
+			entity: &struct {
+				Deleted string `orm:"soft_delete"`
+			}{},
+			wantErr: errs.NewErrInvalidSoftDelete("Deleted", reflect.TypeOf("")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewRegistry().Register(tc.entity)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.NotNil(t, m.SoftDelete)
+		})
+	}
+}
+
+func TestRegistry_RegisterModel(t *testing.T) {
+	type VersionModel struct {
+		Version string
+	}
+	fd := &Field{GoName: "Version", ColName: "version", Type: reflect.TypeOf("")}
+	// 和 Register 一样校验字段类型，例如代码生成的元数据
+	err := NewRegistry().RegisterModel(&VersionModel{}, &Model{
+		TableName: "version_model",
+		Fields:    []*Field{fd},
+		Version:   fd,
+	})
+	assert.Equal(t, errs.NewErrInvalidVersion("Version", reflect.TypeOf("")), err)
+}
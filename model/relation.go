@@ -0,0 +1,145 @@
+package model
+
+import (
+	"reflect"
+	"web/orm/internal/errs"
+)
+
+const (
+	// tagKeyRel 关联关系的类型，例如 orm:"rel=has_many,fk=UserId"
+	tagKeyRel = "rel"
+	// tagKeyFK 外键字段的 Go 名字
+	tagKeyFK = "fk"
+	// tagKeyRefs 外键引用的字段的 Go 名字，默认是 Id
+	tagKeyRefs = "refs"
+	// 下面三个只用于多对多，都是中间表的表名和列名
+	tagKeyJoinTable = "join_table"
+	tagKeyJoinFK    = "join_fk"
+	tagKeyJoinRefs  = "join_refs"
+	// tagKeyTargetRefs 多对多的时候中间表指向的关联模型字段的 Go 名字，默认是 Id
+	tagKeyTargetRefs = "target_refs"
+)
+
+type RelationType string
+
+const (
+	// BelongsTo 外键在本模型上，例如 Order.User，外键是 Order.UserId
+	BelongsTo RelationType = "belongs_to"
+	// HasOne 外键在关联模型上，例如 User.Profile，外键是 Profile.UserId
+	HasOne RelationType = "has_one"
+	// HasMany 和 HasOne 一样，不过字段是切片，例如 User.Orders
+	HasMany RelationType = "has_many"
+	// ManyToMany 通过中间表关联，例如 User.Roles 对应 user_role 表
+	ManyToMany RelationType = "many_to_many"
+)
+
+// Relation 关联关系的元数据
+type Relation struct {
+	// FieldName 关联字段在本模型中的 Go 名字
+	FieldName string
+	Type      RelationType
+	// Target 关联模型的结构体类型，已经去掉了切片和指针
+	Target reflect.Type
+	// ForeignKey 外键字段的 Go 名字
+	// BelongsTo 的时候在本模型上，其余情况在关联模型上
+	ForeignKey string
+	// References 外键引用的字段的 Go 名字
+	// BelongsTo 的时候在关联模型上，其余情况在本模型上
+	References string
+
+	// 多对多的中间表，这里用的都是列名，因为中间表一般没有模型
+	JoinTable string
+	// JoinForeignKey 中间表中指向本模型的列
+	JoinForeignKey string
+	// JoinReferences 中间表中指向关联模型的列
+	JoinReferences string
+	// TargetReferences JoinReferences 引用的关联模型字段的 Go 名字
+	TargetReferences string
+}
+
+// Entity 构造一个关联模型的指针，方便通过 Registry 拿到关联模型的元数据
+func (r *Relation) Entity() any {
+	return reflect.New(r.Target).Interface()
+}
+
+// parseRelation 解析字段上的关联关系，owner 是本模型的结构体名
+// 关联模型的元数据在用到的时候才解析，避免两个模型互相引用导致无限递归
+func parseRelation(owner string, f reflect.StructField, pair map[string]string) (*Relation, error) {
+	typ := f.Type
+	slice := typ.Kind() == reflect.Slice
+	if slice {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, errs.NewErrInvalidRelation(f.Name, "关联的必须是结构体")
+	}
+	rel, err := ParseRelation(owner, f.Name, typ.Name(), slice, pair)
+	if err != nil {
+		return nil, err
+	}
+	rel.Target = typ
+	return rel, nil
+}
+
+// ParseRelation 根据标签校验关联关系并补上默认值，Target 需要调用方自己设置
+// owner 是本模型的结构体名，field 是关联字段的名字，target 是关联模型的结构体名，
+// slice 表示关联字段是不是切片。ormgen 没有 reflect.Type，所以这里只用名字
+func ParseRelation(owner, field, target string, slice bool, pair map[string]string) (*Relation, error) {
+	rel := &Relation{
+		FieldName:        field,
+		Type:             RelationType(pair[tagKeyRel]),
+		ForeignKey:       pair[tagKeyFK],
+		References:       pair[tagKeyRefs],
+		TargetReferences: pair[tagKeyTargetRefs],
+	}
+	if rel.References == "" {
+		rel.References = "Id"
+	}
+	switch rel.Type {
+	case HasMany, ManyToMany:
+		if !slice {
+			return nil, errs.NewErrInvalidRelation(field, "必须是切片")
+		}
+	case HasOne, BelongsTo:
+		if slice {
+			return nil, errs.NewErrInvalidRelation(field, "不能是切片")
+		}
+	default:
+		return nil, errs.NewErrInvalidRelation(field, "不支持的类型 "+string(rel.Type))
+	}
+
+	if rel.ForeignKey == "" {
+		switch rel.Type {
+		case BelongsTo:
+			// Order.User 默认外键是 Order.UserId
+			rel.ForeignKey = field + "Id"
+		default:
+			// User.Orders 默认外键是 Order.UserId
+			rel.ForeignKey = owner + "Id"
+		}
+	}
+
+	if rel.Type == ManyToMany {
+		if rel.TargetReferences == "" {
+			rel.TargetReferences = "Id"
+		}
+		rel.JoinTable = pair[tagKeyJoinTable]
+		if rel.JoinTable == "" {
+			rel.JoinTable = UnderscoreCase(owner) + "_" + UnderscoreCase(target)
+		}
+		rel.JoinForeignKey = pair[tagKeyJoinFK]
+		if rel.JoinForeignKey == "" {
+			rel.JoinForeignKey = UnderscoreCase(owner) + "_id"
+		}
+		rel.JoinReferences = pair[tagKeyJoinRefs]
+		if rel.JoinReferences == "" {
+			rel.JoinReferences = UnderscoreCase(target) + "_id"
+		}
+	} else if rel.TargetReferences != "" {
+		return nil, errs.NewErrInvalidRelation(field, "只有多对多可以设置 "+tagKeyTargetRefs)
+	}
+	return rel, nil
+}
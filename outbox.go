@@ -0,0 +1,134 @@
+package orm
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// OutboxMessage 事务发件箱里面的消息
+// 业务数据和消息在同一个事务里面写入，事务提交之后再由 OutboxRelay 投递，
+// 这样就不会出现数据写进去了但是消息没有发出去，或者反过来的情况
+type OutboxMessage struct {
+	Id      int64
+	Topic   string
+	Payload []byte
+	// Sent 是否已经投递成功
+	Sent  bool
+	Ctime int64 `orm:"auto_create_time=milli"`
+}
+
+// TableName 发件箱固定使用 orm_outbox 表
+func (m *OutboxMessage) TableName() string {
+	return "orm_outbox"
+}
+
+// PublishOutbox 往发件箱写入一条消息
+// sess 应该是业务数据所在的事务，或者 context 里面带着事务的 DB
+func PublishOutbox(ctx context.Context, sess Session, topic string, payload []byte) error {
+	return NewInserter[OutboxMessage](sess).Columns("Topic", "Payload", "Sent", "Ctime").
+		Values(&OutboxMessage{Topic: topic, Payload: payload}).Exec(ctx).Err()
+}
+
+// OutboxHandler 投递消息，返回 error 的时候这一批消息会在下一次重新投递，
+// 所以至少会投递一次，消费者需要自己保证幂等
+type OutboxHandler func(ctx context.Context, msgs []*OutboxMessage) error
+
+// OutboxRelay 把发件箱里面没有投递的消息交给 OutboxHandler
+// 读取的时候使用 FOR UPDATE SKIP LOCKED，所以可以同时运行多个实例
+type OutboxRelay struct {
+	db        *DB
+	handler   OutboxHandler
+	batchSize int
+	interval  time.Duration
+	logger    *slog.Logger
+}
+
+type OutboxRelayOption func(r *OutboxRelay)
+
+func NewOutboxRelay(db *DB, handler OutboxHandler, opts ...OutboxRelayOption) *OutboxRelay {
+	res := &OutboxRelay{
+		db:        db,
+		handler:   handler,
+		batchSize: 100,
+		interval:  time.Second,
+		logger:    slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// OutboxRelayWithBatchSize 每一批最多投递多少条消息
+func OutboxRelayWithBatchSize(n int) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.batchSize = n
+	}
+}
+
+// OutboxRelayWithInterval 没有消息的时候隔多久再查一次
+func OutboxRelayWithInterval(interval time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.interval = interval
+	}
+}
+
+// OutboxRelayWithLogger Run 投递失败的时候通过 logger 输出，默认是 slog.Default()
+func OutboxRelayWithLogger(logger *slog.Logger) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.logger = logger
+	}
+}
+
+// RelayOnce 投递一批消息，返回投递了多少条
+// 读取、投递、标记已投递在同一个事务里面，投递失败的时候事务会回滚
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	var cnt int
+	err := r.db.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+		msgs, err := NewSelector[OutboxMessage](tx).Where(C("Sent").Eq(false)).
+			OrderBy(Asc("Id")).Limit(r.batchSize).SkipLocked().GetMulti(ctx)
+		if err != nil || len(msgs) == 0 {
+			return err
+		}
+		if err = r.handler(ctx, msgs); err != nil {
+			return err
+		}
+		ids := make([]any, 0, len(msgs))
+		for _, msg := range msgs {
+			ids = append(ids, msg.Id)
+		}
+		cnt = len(msgs)
+		return NewUpdater[OutboxMessage](tx).Set(Assign("Sent", true)).
+			Where(C("Id").In(ids...)).Exec(ctx).Err()
+	}, nil, TxWithPropagation(PropagationRequiresNew))
+	if err != nil {
+		return 0, err
+	}
+	return cnt, nil
+}
+
+// Run 持续投递消息，直到 ctx 被取消
+// 一批消息满了说明可能还有积压，会马上投递下一批，否则等待 interval
+// 投递失败的时候也是等待 interval 之后重试
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	for {
+		cnt, err := r.RelayOnce(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			r.logger.LogAttrs(ctx, slog.LevelError, "orm: relay outbox",
+				slog.String("error", err.Error()))
+		} else if cnt >= r.batchSize {
+			continue
+		}
+		timer := time.NewTimer(r.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestOutboxRelay_RunLogger(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+	mock.ExpectBegin().WillReturnError(sqlmock.ErrCancelled)
+
+	buf := &bytes.Buffer{}
+	relay := NewOutboxRelay(db, func(ctx context.Context, msgs []*OutboxMessage) error {
+		return nil
+	}, OutboxRelayWithInterval(time.Hour), OutboxRelayWithLogger(slog.New(slog.NewTextHandler(buf, nil))))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// 投递失败之后等待 interval，直到 ctx 结束
+	assert.ErrorIs(t, relay.Run(ctx), context.DeadlineExceeded)
+	assert.Contains(t, buf.String(), `level=ERROR msg="orm: relay outbox" error=`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -9,6 +9,7 @@ const (
 	opNot op = "NOT"
 	opAnd op = "AND"
 	opOr  op = "OR"
+	opIn  op = "IN"
 )
 
 // Predicate 查询条件结构体
@@ -58,3 +59,10 @@ type value struct {
 }
 
 func (value) expr() {}
+
+// values 代表一组值，用于 IN (?,?,?)
+type values struct {
+	vals []any
+}
+
+func (values) expr() {}
@@ -0,0 +1,307 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"web/orm/internal/errs"
+	"web/orm/model"
+)
+
+// preloadNode 预加载树，"Orders.Items" 会变成 Orders -> Items 两个节点
+// 这样同一个关联只会查询一次
+type preloadNode struct {
+	// 加载这一层关联时额外的条件
+	where []Predicate
+	// names 用来保持用户调用 Preload 的顺序
+	names    []string
+	children map[string]*preloadNode
+}
+
+func (n *preloadNode) add(path string, ps []Predicate) {
+	cur := n
+	for _, name := range strings.Split(path, ".") {
+		if cur.children == nil {
+			cur.children = make(map[string]*preloadNode, 2)
+		}
+		child, ok := cur.children[name]
+		if !ok {
+			child = &preloadNode{}
+			cur.children[name] = child
+			cur.names = append(cur.names, name)
+		}
+		cur = child
+	}
+	cur.where = append(cur.where, ps...)
+}
+
+// preload 为 parents 加载 node 下面的所有关联
+// parents 都是指向 m 对应结构体的指针
+func preload(ctx context.Context, sess Session, c core, m *model.Model,
+	parents []reflect.Value, node *preloadNode) error {
+	if len(parents) == 0 {
+		return nil
+	}
+	for _, name := range node.names {
+		rel, ok := m.RelationMap[name]
+		if !ok {
+			return errs.NewErrUnknownRelation(name)
+		}
+		if err := preloadRelation(ctx, sess, c, m, rel, parents, node.children[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preloadRelation 一个关联发一次 IN 查询，多对多额外查一次中间表
+func preloadRelation(ctx context.Context, sess Session, c core, m *model.Model, rel *model.Relation,
+	parents []reflect.Value, node *preloadNode) error {
+	rm, err := c.r.Get(rel.Entity())
+	if err != nil {
+		return err
+	}
+
+	// parentKey 父模型上用来关联的字段，childKey 子模型上对应的字段
+	parentKey, childKey := rel.References, rel.ForeignKey
+	if rel.Type == model.BelongsTo {
+		parentKey, childKey = rel.ForeignKey, rel.References
+	}
+	if rel.Type == model.ManyToMany {
+		childKey = rel.TargetReferences
+	}
+	if _, ok := m.FieldMap[parentKey]; !ok {
+		return errs.NewErrUnknownField(parentKey)
+	}
+	if _, ok := rm.FieldMap[childKey]; !ok {
+		return errs.NewErrUnknownField(childKey)
+	}
+	keys := fieldValues(parents, parentKey)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// 多对多：先查中间表，拿到父模型的键到子模型键的映射
+	var joins map[string][]string
+	if rel.Type == model.ManyToMany {
+		var targetKeys []any
+		joins, targetKeys, err = loadJoinTable(ctx, sess, rel, keys)
+		if err != nil {
+			return err
+		}
+		if len(targetKeys) == 0 {
+			return nil
+		}
+		keys = targetKeys
+	}
+
+	children, err := loadChildren(ctx, sess, c, rel, rm, childKey, keys, node.where)
+	if err != nil {
+		return err
+	}
+	// 先加载下一层，因为值类型的字段赋值之后就是副本了
+	if err = preload(ctx, sess, c, rm, children, node); err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err = afterFind(ctx, child.Interface()); err != nil {
+			return err
+		}
+	}
+
+	// 按照子模型上的键分组
+	grouped := make(map[string][]reflect.Value, len(children))
+	for _, child := range children {
+		k := keyOf(child.Elem().FieldByName(childKey).Interface())
+		grouped[k] = append(grouped[k], child)
+	}
+
+	for _, parent := range parents {
+		pk := keyOf(parent.Elem().FieldByName(parentKey).Interface())
+		var matched []reflect.Value
+		if rel.Type == model.ManyToMany {
+			for _, ck := range joins[pk] {
+				matched = append(matched, grouped[ck]...)
+			}
+		} else {
+			matched = grouped[pk]
+		}
+		assignRelation(parent.Elem().FieldByName(rel.FieldName), matched)
+	}
+	return nil
+}
+
+// loadChildren SELECT * FROM `child` WHERE `key` IN (...)
+func loadChildren(ctx context.Context, sess Session, c core, rel *model.Relation, rm *model.Model,
+	key string, keys []any, where []Predicate) ([]reflect.Value, error) {
+	// 子模型的类型只有在运行时才知道，所以这里借用 Selector 来构造 SQL，
+	// 元数据直接指定为子模型，类型参数并不会被用到
+	s := NewSelector[any](sess)
+	s.model = rm
+	s.Where(append([]Predicate{C(key).In(keys...)}, where...)...)
+	res := queryRows(ctx, sess, c, &QueryContext{
+		Type:    "SELECT",
+		Builder: s,
+		Model:   rm,
+	}, func(rows *sql.Rows) (any, error) {
+		// 结果是 []*Child，这样缓存之类的中间件可以像处理 GetMulti 的结果一样处理它
+		children := reflect.MakeSlice(reflect.SliceOf(reflect.PointerTo(rel.Target)), 0, len(keys))
+		for rows.Next() {
+			child := reflect.New(rel.Target)
+			if err := c.creator(rm, child.Interface()).SetColumn(rows); err != nil {
+				return nil, err
+			}
+			children = reflect.Append(children, child)
+		}
+		return children.Interface(), nil
+	})
+	if res.Err != nil || res.Result == nil {
+		return nil, res.Err
+	}
+	children := reflect.ValueOf(res.Result)
+	vals := make([]reflect.Value, 0, children.Len())
+	for i := 0; i < children.Len(); i++ {
+		vals = append(vals, children.Index(i))
+	}
+	return vals, nil
+}
+
+// joinTableQuery SELECT `join_fk`,`join_refs` FROM `join_table` WHERE `join_fk` IN (...)
+type joinTableQuery struct {
+	builder
+	rel  *model.Relation
+	keys []any
+}
+
+func (j *joinTableQuery) Build() (*Query, error) {
+	j.reset()
+	j.sb.WriteString("SELECT ")
+	j.quote(j.rel.JoinForeignKey)
+	j.sb.WriteByte(',')
+	j.quote(j.rel.JoinReferences)
+	j.sb.WriteString(" FROM ")
+	j.quote(j.rel.JoinTable)
+	j.sb.WriteString(" WHERE ")
+	j.quote(j.rel.JoinForeignKey)
+	j.sb.WriteString(" IN (")
+	for i, k := range j.keys {
+		if i > 0 {
+			j.sb.WriteByte(',')
+		}
+		j.sb.WriteByte('?')
+		j.addArgs(k)
+	}
+	j.sb.WriteString(");")
+	return &Query{
+		SQL:  j.sb.String(),
+		Args: j.args,
+	}, nil
+}
+
+// joinRow 中间表的一行
+type joinRow struct {
+	fk  any
+	ref any
+}
+
+// loadJoinTable 查询中间表，返回父模型的键到子模型键的映射，以及去重之后的子模型键
+func loadJoinTable(ctx context.Context, sess Session, rel *model.Relation,
+	keys []any) (map[string][]string, []any, error) {
+	c := sess.getCore()
+	res := queryRows(ctx, sess, c, &QueryContext{
+		Type: "SELECT",
+		Builder: &joinTableQuery{
+			builder: builder{core: c, quoter: c.dialect.quoter()},
+			rel:     rel,
+			keys:    keys,
+		},
+	}, func(rows *sql.Rows) (any, error) {
+		var jrs []joinRow
+		for rows.Next() {
+			var jr joinRow
+			if err := rows.Scan(&jr.fk, &jr.ref); err != nil {
+				return nil, err
+			}
+			jrs = append(jrs, jr)
+		}
+		return jrs, nil
+	})
+	if res.Err != nil {
+		return nil, nil, res.Err
+	}
+	jrs, _ := res.Result.([]joinRow)
+
+	joins := make(map[string][]string, len(keys))
+	var targetKeys []any
+	seen := make(map[string]bool, len(keys))
+	for _, jr := range jrs {
+		fkKey, refKey := keyOf(jr.fk), keyOf(jr.ref)
+		joins[fkKey] = append(joins[fkKey], refKey)
+		if !seen[refKey] {
+			seen[refKey] = true
+			targetKeys = append(targetKeys, jr.ref)
+		}
+	}
+	return joins, targetKeys, nil
+}
+
+// assignRelation 把查出来的子模型赋值给父模型的关联字段
+func assignRelation(field reflect.Value, children []reflect.Value) {
+	switch field.Kind() {
+	case reflect.Slice:
+		res := reflect.MakeSlice(field.Type(), 0, len(children))
+		isPtr := field.Type().Elem().Kind() == reflect.Ptr
+		for _, child := range children {
+			if isPtr {
+				res = reflect.Append(res, child)
+			} else {
+				res = reflect.Append(res, child.Elem())
+			}
+		}
+		field.Set(res)
+	case reflect.Ptr:
+		if len(children) > 0 {
+			field.Set(children[0])
+		}
+	default:
+		if len(children) > 0 {
+			field.Set(children[0].Elem())
+		}
+	}
+}
+
+// fieldValues 取出 vals 上某个字段去重之后的值，作为 IN 的参数
+func fieldValues(vals []reflect.Value, name string) []any {
+	res := make([]any, 0, len(vals))
+	seen := make(map[string]bool, len(vals))
+	for _, val := range vals {
+		v := val.Elem().FieldByName(name).Interface()
+		k := keyOf(v)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		res = append(res, v)
+	}
+	return res
+}
+
+// keyOf 把关联键统一转换成字符串，
+// 因为父子模型以及中间表里面同一个键的 Go 类型未必一样，例如 int64 和 []byte
+func keyOf(val any) string {
+	switch v := val.(type) {
+	case []byte:
+		return string(v)
+	default:
+		rv := reflect.ValueOf(val)
+		for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		if !rv.IsValid() || rv.Kind() == reflect.Ptr {
+			return ""
+		}
+		return fmt.Sprint(rv.Interface())
+	}
+}
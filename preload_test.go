@@ -0,0 +1,174 @@
+package orm
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"web/orm/internal/errs"
+	"web/orm/internal/valuer"
+	"web/orm/model"
+)
+
+func TestSelector_Preload(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	db := &DB{
+		db: mockDB,
+		core: core{
+			r:       model.NewRegistry(),
+			dialect: DialectMySOL,
+			creator: valuer.NewUnsafeValue,
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		s        *Selector[PreloadUser]
+		mockRows func()
+		wantRes  []*PreloadUser
+		wantErr  error
+	}{
+		{
+			name: "has many and nested",
+			s:    NewSelector[PreloadUser](db).Preload("Orders.Items", C("Price").Gt(10)),
+			mockRows: func() {
+				mock.ExpectQuery("SELECT \\* FROM `preload_user`;").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+				mock.ExpectQuery("SELECT \\* FROM `preload_order` WHERE `preload_user_id` IN \\(\\?,\\?\\);").
+					WithArgs(int64(1), int64(2)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "preload_user_id"}).
+						AddRow(11, 1).AddRow(12, 1).AddRow(21, 2))
+				mock.ExpectQuery("SELECT \\* FROM `preload_item` WHERE \\(`preload_order_id` IN \\(\\?,\\?,\\?\\)\\) AND \\(`price` > \\?\\);").
+					WithArgs(int64(11), int64(12), int64(21), 10).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "preload_order_id", "price"}).
+						AddRow(111, 11, 20))
+			},
+			wantRes: []*PreloadUser{
+				{
+					Id: 1,
+					Orders: []*PreloadOrder{
+						{Id: 11, PreloadUserId: 1, Items: []PreloadItem{{Id: 111, PreloadOrderId: 11, Price: 20}}},
+						{Id: 12, PreloadUserId: 1, Items: []PreloadItem{}},
+					},
+				},
+				{
+					Id: 2,
+					Orders: []*PreloadOrder{
+						{Id: 21, PreloadUserId: 2, Items: []PreloadItem{}},
+					},
+				},
+			},
+		},
+		{
+			name: "many to many",
+			s:    NewSelector[PreloadUser](db).Preload("Tags"),
+			mockRows: func() {
+				mock.ExpectQuery("SELECT \\* FROM `preload_user`;").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+				mock.ExpectQuery("SELECT `preload_user_id`,`preload_tag_id` FROM `preload_user_preload_tag` WHERE `preload_user_id` IN \\(\\?,\\?\\);").
+					WithArgs(int64(1), int64(2)).
+					WillReturnRows(sqlmock.NewRows([]string{"preload_user_id", "preload_tag_id"}).
+						AddRow(1, 7).AddRow(2, 7).AddRow(2, 8))
+				mock.ExpectQuery("SELECT \\* FROM `preload_tag` WHERE `id` IN \\(\\?,\\?\\);").
+					WithArgs(int64(7), int64(8)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7).AddRow(8))
+			},
+			wantRes: []*PreloadUser{
+				{Id: 1, Tags: []*PreloadTag{{Id: 7}}},
+				{Id: 2, Tags: []*PreloadTag{{Id: 7}, {Id: 8}}},
+			},
+		},
+		{
+			name: "unknown relation",
+			s:    NewSelector[PreloadUser](db).Preload("Invalid"),
+			mockRows: func() {
+				mock.ExpectQuery("SELECT \\* FROM `preload_user`;").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			},
+			wantErr: errs.NewErrUnknownRelation("Invalid"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockRows()
+			res, err := tc.s.GetMulti(context.Background())
+			assert.Equal(t, tc.wantErr, err)
+			require.NoError(t, mock.ExpectationsWereMet())
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestSelector_PreloadMiddleware(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	// 预加载的查询和主查询一样要经过中间件
+	var sqls []string
+	db := &DB{
+		db: mockDB,
+		core: core{
+			r:       model.NewRegistry(),
+			dialect: DialectMySOL,
+			creator: valuer.NewUnsafeValue,
+			mdls: []Middleware{func(next Handler) Handler {
+				return func(ctx context.Context, qc *QueryContext) *QueryResult {
+					q, err := qc.Query()
+					require.NoError(t, err)
+					sqls = append(sqls, q.SQL)
+					return next(ctx, qc)
+				}
+			}},
+		},
+	}
+
+	mock.ExpectQuery("SELECT \\* FROM `preload_user`;").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `preload_user_id`,`preload_tag_id` FROM `preload_user_preload_tag` WHERE `preload_user_id` IN \\(\\?\\);").
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"preload_user_id", "preload_tag_id"}).AddRow(1, 7))
+	mock.ExpectQuery("SELECT \\* FROM `preload_tag` WHERE `id` IN \\(\\?\\);").
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+	res, err := NewSelector[PreloadUser](db).Preload("Tags").GetMulti(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []*PreloadUser{{Id: 1, Tags: []*PreloadTag{{Id: 7}}}}, res)
+	assert.Equal(t, []string{
+		"SELECT * FROM `preload_user`;",
+		"SELECT `preload_user_id`,`preload_tag_id` FROM `preload_user_preload_tag` WHERE `preload_user_id` IN (?);",
+		"SELECT * FROM `preload_tag` WHERE `id` IN (?);",
+	}, sqls)
+}
+
+type PreloadUser struct {
+	Id     int64
+	Orders []*PreloadOrder `orm:"rel=has_many"`
+	Tags   []*PreloadTag   `orm:"rel=many_to_many"`
+}
+
+type PreloadOrder struct {
+	Id            int64
+	PreloadUserId int64
+	Items         []PreloadItem `orm:"rel=has_many"`
+}
+
+type PreloadItem struct {
+	Id             int64
+	PreloadOrderId int64
+	Price          int64
+}
+
+type PreloadTag struct {
+	Id int64
+}
@@ -0,0 +1,63 @@
+package orm
+
+import "context"
+
+// Propagation 事务的传播方式，决定 DoTx 遇到 context 里面已经有事务的时候怎么处理
+type Propagation uint8
+
+const (
+	// PropagationRequired 有事务就加入，没有就开启一个新的事务，这是默认值
+	PropagationRequired Propagation = iota
+	// PropagationRequiresNew 总是开启一个新的事务，和外层事务互不影响
+	PropagationRequiresNew
+	// PropagationSupported 有事务就加入，没有就不使用事务，这个时候 fn 拿到的 tx 是 nil
+	PropagationSupported
+	// PropagationNested 有事务就通过保存点开启嵌套事务，没有就开启一个新的事务
+	PropagationNested
+)
+
+type TxOption func(o *txOptions)
+
+type txOptions struct {
+	propagation Propagation
+	retry       *RetryPolicy
+}
+
+// TxWithPropagation 指定 DoTx 的传播方式
+func TxWithPropagation(p Propagation) TxOption {
+	return func(o *txOptions) {
+		o.propagation = p
+	}
+}
+
+type txKey struct{}
+
+// WithTx 把事务放进 context 里面
+// 之后用 DB 执行的语句都会在这个事务里面执行，
+// 这样 service 层开启的事务就能自动传递给只拿到 DB 的 repository
+func WithTx(ctx context.Context, tx *Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TxFromContext 拿到 context 里面的事务
+func TxFromContext(ctx context.Context) (*Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*Tx)
+	return tx, ok && tx != nil
+}
+
+// txFromContext 只有事务是这个 DB 开启的才会使用
+func (db *DB) txFromContext(ctx context.Context) (*Tx, bool) {
+	tx, ok := TxFromContext(ctx)
+	if !ok || tx.db != db {
+		return nil, false
+	}
+	return tx, true
+}
+
+// Session 拿到 ctx 对应的 Session，context 里面有事务就是 *Tx，否则就是 DB 本身
+func (db *DB) Session(ctx context.Context) Session {
+	if tx, ok := db.txFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
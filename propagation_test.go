@@ -0,0 +1,144 @@
+package orm
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+)
+
+func TestDB_DoTxPropagation(t *testing.T) {
+	deleteSQL := regexp.QuoteMeta("DELETE FROM `test_model` WHERE `id` = ?;")
+	testCases := []struct {
+		name string
+		mock func(mock sqlmock.Sqlmock)
+		// outer 为 true 的时候先开启一个外层事务
+		outer       bool
+		propagation Propagation
+		// wantJoin 内层拿到的是不是外层的事务
+		wantJoin bool
+		wantNil  bool
+	}{
+		{
+			name: "required join",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(deleteSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			outer:       true,
+			propagation: PropagationRequired,
+			wantJoin:    true,
+		},
+		{
+			name: "required new",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(deleteSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			propagation: PropagationRequired,
+		},
+		{
+			name: "requires new",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectBegin()
+				mock.ExpectExec(deleteSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectCommit()
+			},
+			outer:       true,
+			propagation: PropagationRequiresNew,
+		},
+		{
+			name: "supported join",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(deleteSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			outer:       true,
+			propagation: PropagationSupported,
+			wantJoin:    true,
+		},
+		{
+			name: "supported without tx",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(deleteSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			propagation: PropagationSupported,
+			wantNil:     true,
+		},
+		{
+			name: "nested",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("SAVEPOINT sp_1;")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(deleteSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("RELEASE SAVEPOINT sp_1;")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			outer:       true,
+			propagation: PropagationNested,
+			wantJoin:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer mockDB.Close()
+			db, err := OpenDB(mockDB)
+			require.NoError(t, err)
+			tc.mock(mock)
+
+			// inner 模拟 repository，只拿到了 DB
+			inner := func(ctx context.Context, outer *Tx) error {
+				return db.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+					assert.Equal(t, tc.wantNil, tx == nil)
+					assert.Equal(t, tc.wantJoin, outer != nil && tx == outer)
+					if tx != nil {
+						assert.Equal(t, tx, db.Session(ctx))
+					}
+					return NewDeleter[TestModel](db).Where(C("Id").Eq(1)).Exec(ctx).Err()
+				}, nil, TxWithPropagation(tc.propagation))
+			}
+			ctx := context.Background()
+			if tc.outer {
+				err = db.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+					return inner(ctx, tx)
+				}, nil)
+			} else {
+				err = inner(ctx, nil)
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDB_Session(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+	other, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	ctx := context.Background()
+	assert.Equal(t, db, db.Session(ctx))
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	ctx = WithTx(ctx, tx)
+	assert.Equal(t, tx, db.Session(ctx))
+	// 别的 DB 开启的事务不能用
+	assert.Equal(t, other, other.Session(ctx))
+}
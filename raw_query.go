@@ -36,6 +36,8 @@ func (s RawQuerier[T]) Get(ctx context.Context) (*T, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 原生 SQL 可能有副作用或者加锁，不能发到从库
+	ctx = UsePrimary(ctx)
 	res := get[T](ctx, s.sess, s.core, &QueryContext{
 		Type:    "RAW",
 		Builder: s,
@@ -48,8 +50,23 @@ func (s RawQuerier[T]) Get(ctx context.Context) (*T, error) {
 }
 
 func (s RawQuerier[T]) GetMulti(ctx context.Context) ([]*T, error) {
-	//TODO implement me
-	panic("implement me")
+	var err error
+	s.model, err = s.r.Get(new(T))
+	if err != nil {
+		return nil, err
+	}
+	// 原生 SQL 可能有副作用或者加锁，不能发到从库
+	ctx = UsePrimary(ctx)
+	res := getMulti[T](ctx, s.sess, s.core, &QueryContext{
+		Type:    "RAW",
+		Builder: s,
+		Model:   s.model,
+	})
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	result, _ := res.Result.([]*T)
+	return result, nil
 }
 
 func (s RawQuerier[T]) Exec(ctx context.Context) Result {
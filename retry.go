@@ -0,0 +1,87 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+	"web/orm/internal/errs"
+)
+
+// RetryPolicy 事务遇到死锁、序列化失败或者锁等待超时的时候怎么重试
+// 重试会重新执行整个闭包，所以闭包里面不能有事务之外的副作用
+type RetryPolicy struct {
+	// MaxAttempts 最多执行多少次，包括第一次
+	MaxAttempts int
+	// Backoff 第一次重试之前等待的时间，之后每一次翻倍
+	Backoff time.Duration
+	// MaxBackoff 等待时间的上限，0 表示没有上限
+	MaxBackoff time.Duration
+	// Jitter 取值 0~1，等待时间会在 [1-Jitter, 1+Jitter] 倍之间随机，避免大家同时重试
+	Jitter float64
+	// Retryable 判断错误能不能重试，为 nil 的时候交给 Dialect 判断
+	// Dialect 的判断是内置的：标准 SQL 看错误链上的 SQLState() string，
+	// MySQL 看错误链上的 ErrorNumber() uint16。驱动的错误不满足这两个接口，
+	// 或者要换一套判断规则的时候，这里是唯一的扩展点
+	Retryable func(err error) bool
+}
+
+// TxWithRetry 指定 DoTx 的重试策略
+// 只有 DoTx 自己开启了事务的时候才会重试，加入外层事务的时候由外层负责重试
+func TxWithRetry(policy RetryPolicy) TxOption {
+	return func(o *txOptions) {
+		o.retry = &policy
+	}
+}
+
+// backoff 第 attempt 次重试之前要等待多久，attempt 从 1 开始
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return d
+}
+
+// doTxWithRetry 重试用完或者遇到不能重试的错误的时候，
+// 返回的错误会包含每一次执行的错误
+func (db *DB) doTxWithRetry(ctx context.Context, fn func(ctx context.Context, tx *Tx) error,
+	opts *sql.TxOptions, policy *RetryPolicy) error {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = db.dialect.retryable
+	}
+	var causes []error
+	for attempt := 1; ; attempt++ {
+		err := db.doTx(ctx, fn, opts)
+		if err == nil {
+			return nil
+		}
+		causes = append(causes, err)
+		if !retryable(err) {
+			break
+		}
+		if attempt >= policy.MaxAttempts {
+			break
+		}
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			causes = append(causes, ctx.Err())
+			return errs.NewErrTxRetryExhausted(attempt, errors.Join(causes...))
+		case <-timer.C:
+		}
+	}
+	if len(causes) == 1 {
+		return causes[0]
+	}
+	return errs.NewErrTxRetryExhausted(len(causes), errors.Join(causes...))
+}
@@ -0,0 +1,163 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDB_DoTxRetry(t *testing.T) {
+	deadlock := mysqlNumberError(1213)
+	lockWait := mysqlNumberError(1205)
+	dupKey := mysqlNumberError(1062)
+	driverDeadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+	testCases := []struct {
+		name   string
+		policy RetryPolicy
+		// errs 每一次执行的错误
+		errs         []error
+		wantAttempts int
+		wantErrs     []error
+	}{
+		{
+			name:         "success after retry",
+			policy:       RetryPolicy{MaxAttempts: 3},
+			errs:         []error{deadlock, lockWait, nil},
+			wantAttempts: 3,
+		},
+		{
+			name:         "exhausted",
+			policy:       RetryPolicy{MaxAttempts: 2},
+			errs:         []error{deadlock, lockWait},
+			wantAttempts: 2,
+			wantErrs:     []error{deadlock, lockWait},
+		},
+		{
+			name:         "not retryable",
+			policy:       RetryPolicy{MaxAttempts: 3},
+			errs:         []error{dupKey},
+			wantAttempts: 1,
+			wantErrs:     []error{dupKey},
+		},
+		{
+			name:         "give up on not retryable",
+			policy:       RetryPolicy{MaxAttempts: 3},
+			errs:         []error{deadlock, dupKey},
+			wantAttempts: 2,
+			wantErrs:     []error{deadlock, dupKey},
+		},
+		{
+			name: "custom retryable",
+			policy: RetryPolicy{MaxAttempts: 3, Retryable: func(err error) bool {
+				return errors.Is(err, dupKey)
+			}},
+			errs:         []error{dupKey, nil},
+			wantAttempts: 2,
+		},
+		{
+			// go-sql-driver/mysql 的错误没有 ErrorNumber，方言不会重试
+			name:         "driver error",
+			policy:       RetryPolicy{MaxAttempts: 3},
+			errs:         []error{driverDeadlock},
+			wantAttempts: 1,
+			wantErrs:     []error{driverDeadlock},
+		},
+		{
+			name: "driver error with retryable",
+			policy: RetryPolicy{MaxAttempts: 3, Retryable: func(err error) bool {
+				var me *mysql.MySQLError
+				return errors.As(err, &me) && (me.Number == 1213 || me.Number == 1205)
+			}},
+			errs:         []error{driverDeadlock, nil},
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer mockDB.Close()
+			db, err := OpenDB(mockDB)
+			require.NoError(t, err)
+
+			for _, e := range tc.errs {
+				mock.ExpectBegin()
+				if e != nil {
+					mock.ExpectExec("DELETE FROM .*").WillReturnError(e)
+					mock.ExpectRollback()
+				} else {
+					mock.ExpectExec("DELETE FROM .*").WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectCommit()
+				}
+			}
+
+			tc.policy.Backoff = time.Millisecond
+			tc.policy.Jitter = 0.5
+			attempts := 0
+			err = db.DoTx(context.Background(), func(ctx context.Context, tx *Tx) error {
+				attempts++
+				return NewDeleter[TestModel](tx).Where(C("Id").Eq(1)).Exec(ctx).Err()
+			}, nil, TxWithRetry(tc.policy))
+			assert.Equal(t, tc.wantAttempts, attempts)
+			if len(tc.wantErrs) == 0 {
+				assert.NoError(t, err)
+			}
+			for _, e := range tc.wantErrs {
+				assert.ErrorIs(t, err, e)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, p.backoff(1))
+	assert.Equal(t, 2*time.Second, p.backoff(2))
+	assert.Equal(t, 4*time.Second, p.backoff(3))
+	assert.Equal(t, 5*time.Second, p.backoff(4))
+	assert.Equal(t, 5*time.Second, p.backoff(100))
+}
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string {
+	return string(e)
+}
+
+func (e sqlStateError) SQLState() string {
+	return string(e)
+}
+
+type mysqlNumberError uint16
+
+func (e mysqlNumberError) Error() string {
+	return "mysql error"
+}
+
+func (e mysqlNumberError) ErrorNumber() uint16 {
+	return uint16(e)
+}
+
+func TestDialect_Retryable(t *testing.T) {
+	assert.True(t, DialectMySOL.retryable(mysqlNumberError(1213)))
+	assert.False(t, DialectMySOL.retryable(mysqlNumberError(1062)))
+	// 错误码沿着错误链查找，不依赖驱动的类型
+	assert.True(t, DialectMySOL.retryable(fmt.Errorf("wrap: %w", mysqlNumberError(1205))))
+	assert.True(t, DialectMySOL.retryable(errors.Join(errors.New("mock error"), mysqlNumberError(1213))))
+	// 只认 ErrorNumber 方法，不按照结构体的名字猜
+	assert.False(t, DialectMySOL.retryable(&mysql.MySQLError{Number: 1213}))
+	assert.True(t, DialectMySOL.timeout(fmt.Errorf("wrap: %w", mysqlNumberError(3024))))
+	assert.False(t, DialectMySOL.timeout(errors.New("mock error")))
+	assert.True(t, DialectMySOL.retryable(sqlStateError("40001")))
+	assert.True(t, DialectSQLite.retryable(sqlStateError("40P01")))
+	assert.False(t, DialectSQLite.retryable(sqlStateError("23505")))
+	assert.False(t, DialectSQLite.retryable(errors.New("mock error")))
+}
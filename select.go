@@ -5,7 +5,9 @@ import (
 	"errors"
 	"reflect"
 	"strings"
+	"time"
 	"web/orm/internal/errs"
+	"web/orm/model"
 )
 
 // Selectable 是一个标记接口
@@ -25,8 +27,19 @@ type Selector[T any] struct {
 	columns []Selectable
 	groupBy []Column    // 添加 groupBy 字段
 	having  []Predicate // 添加 having 字段
+	orderBy []OrderBy
+	limit   int
+	offset  int
+	// lock 加锁的方式，例如 FOR UPDATE
+	lock lockMode
+	// timeout 单条语句的超时时间，0 表示不限制
+	timeout time.Duration
+
+	// 需要预加载的关联
+	preloads *preloadNode
+	// unscoped 为 true 的时候不会过滤软删除的数据
+	unscoped bool
 
-	core
 	sess Session
 }
 
@@ -38,12 +51,12 @@ func NewSelector[T any](sess Session) *Selector[T] {
 			core:   c,
 			quoter: c.dialect.quoter(),
 		},
-		core: c,
 	}
 }
 
 // Build 解析字段，构造对应的查询语句
 func (s *Selector[T]) Build() (*Query, error) {
+	s.reset()
 	var err error
 	if s.model == nil {
 		s.model, err = s.r.Get(new(T))
@@ -52,6 +65,9 @@ func (s *Selector[T]) Build() (*Query, error) {
 		}
 	}
 	s.sb.WriteString("SELECT ")
+	if s.timeout > 0 {
+		s.sb.WriteString(s.dialect.executionTimeHint(s.timeout))
+	}
 	err = s.buildColumns()
 	if err != nil {
 		return nil, err
@@ -75,12 +91,21 @@ func (s *Selector[T]) Build() (*Query, error) {
 	//	s.sb.WriteByte('`')
 	//}
 
-	if len(s.where) > 0 {
+	where := s.where
+	if !s.unscoped {
+		// 自动过滤掉软删除的数据，注意不能修改 s.where 本身
+		ps, err := s.notDeletedWhere(s.table, false)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where[:len(where):len(where)], ps...)
+	}
+	if len(where) > 0 {
 		s.sb.WriteString(" WHERE ")
-		p := s.where[0]
+		p := where[0]
 		// 拼接
-		for i := 1; i < len(s.where); i++ {
-			p = p.And(s.where[i])
+		for i := 1; i < len(where); i++ {
+			p = p.And(where[i])
 		}
 		if err = s.buildExpression(p); err != nil {
 			return nil, err
@@ -114,6 +139,32 @@ func (s *Selector[T]) Build() (*Query, error) {
 		}
 	}
 
+	if len(s.orderBy) > 0 {
+		s.sb.WriteString(" ORDER BY ")
+		for i, ob := range s.orderBy {
+			if i > 0 {
+				s.sb.WriteByte(',')
+			}
+			if err = s.buildColumn(ob.col); err != nil {
+				return nil, err
+			}
+			s.sb.WriteString(" " + ob.order)
+		}
+	}
+
+	if s.limit > 0 {
+		s.sb.WriteString(" LIMIT ?")
+		s.addArgs(s.limit)
+	}
+	if s.offset > 0 {
+		s.sb.WriteString(" OFFSET ?")
+		s.addArgs(s.offset)
+	}
+
+	if s.lock != lockNone {
+		s.sb.WriteString(s.dialect.lockClause(s.lock == lockSkipLocked))
+	}
+
 	s.sb.WriteByte(';')
 	return &Query{
 		SQL:  s.sb.String(),
@@ -138,6 +189,9 @@ func (s *Selector[T]) buildTable(table TableReference) error {
 			s.quote(t.alias)
 		}
 	case Join:
+		if t.relation != "" {
+			return s.buildRelationJoin(t)
+		}
 		s.sb.WriteByte('(')
 		// 构造右边
 		err := s.buildTable(t.left)
@@ -167,9 +221,18 @@ func (s *Selector[T]) buildTable(table TableReference) error {
 
 		if len(t.on) > 0 {
 			s.sb.WriteString(" ON ")
-			p := t.on[0]
-			for i := 1; i < len(t.on); i++ {
-				p = p.And(t.on[i])
+			on := t.on
+			if !s.unscoped {
+				// 被连接的表的软删除条件放在 ON 里面，这样 LEFT JOIN 的语义不会被破坏
+				ps, err := s.notDeletedWhere(t.right, true)
+				if err != nil {
+					return err
+				}
+				on = append(on[:len(on):len(on)], ps...)
+			}
+			p := on[0]
+			for i := 1; i < len(on); i++ {
+				p = p.And(on[i])
 			}
 			// HAVING COUNT(`age`) > ?
 			// Aggregate opGt value
@@ -184,71 +247,148 @@ func (s *Selector[T]) buildTable(table TableReference) error {
 	return nil
 }
 
-func (s *Selector[T]) buildExpression(expr Expression) error {
-	switch exp := expr.(type) {
-	// 如果是nil就执行就什么都不做
-	case nil:
-	// 如果是Predicate，说明是表达式，用递归不断筛选出合适的进行构造
-	case Predicate:
-		_, ok := exp.left.(Predicate)
-		if ok {
-			s.sb.WriteByte('(')
-		}
-		if err := s.buildExpression(exp.left); err != nil {
+// buildRelationJoin 根据关联关系构造 JOIN
+// 多对多会连接两次：先连接中间表，再连接关联模型的表
+func (s *Selector[T]) buildRelationJoin(j Join) error {
+	left, ok := j.left.(Table)
+	if !ok {
+		return errs.NewErrUnsupportedTable(j.left)
+	}
+	lm, err := s.r.Get(left.entity)
+	if err != nil {
+		return err
+	}
+	rel, ok := lm.RelationMap[j.relation]
+	if !ok {
+		return errs.NewErrUnknownRelation(j.relation)
+	}
+	rm, err := s.r.Get(rel.Entity())
+	if err != nil {
+		return err
+	}
+	leftName := left.alias
+	if leftName == "" {
+		leftName = lm.TableName
+	}
+
+	s.sb.WriteByte('(')
+	if err = s.buildTable(left); err != nil {
+		return err
+	}
+	s.sb.WriteString(j.typ)
+	switch rel.Type {
+	case model.BelongsTo:
+		// `order`.`user_id`=`user`.`id`
+		err = s.buildRelationOn(leftName, lm, rel.ForeignKey, rm, rel.References)
+	case model.HasOne, model.HasMany:
+		// `user`.`id`=`order`.`user_id`
+		err = s.buildRelationOn(leftName, lm, rel.References, rm, rel.ForeignKey)
+	case model.ManyToMany:
+		// `user`.`id`=`user_role`.`user_id` JOIN `role` ON `user_role`.`role_id`=`role`.`id`
+		var fd *model.Field
+		if fd, err = s.relationField(lm, rel.References); err != nil {
 			return err
 		}
-		if ok {
-			s.sb.WriteByte(')')
+		s.quote(rel.JoinTable)
+		s.sb.WriteString(" ON ")
+		s.buildQualified(leftName, fd.ColName)
+		s.sb.WriteByte('=')
+		s.buildQualified(rel.JoinTable, rel.JoinForeignKey)
+		s.sb.WriteString(j.typ)
+		if fd, err = s.relationField(rm, rel.TargetReferences); err != nil {
+			return err
 		}
+		s.quote(rm.TableName)
+		s.sb.WriteString(" ON ")
+		s.buildQualified(rel.JoinTable, rel.JoinReferences)
+		s.sb.WriteByte('=')
+		s.buildQualified(rm.TableName, fd.ColName)
+	}
+	if err != nil {
+		return err
+	}
+	if !s.unscoped && rm.SoftDelete != nil {
+		s.sb.WriteString(" AND ")
+		s.buildSoftDelete(softDeleteExpr{qualifier: rm.TableName, fd: rm.SoftDelete})
+	}
+	s.sb.WriteByte(')')
+	return nil
+}
 
-		if exp.op != "" {
-			s.sb.WriteString(" " + exp.op.String() + " ")
+// notDeletedWhere 软删除的条件
+// 对于 JOIN 来说，这里处理最左边的表、USING 连接的表以及没有连接条件的表，
+// 用 ON 连接的表和按照关联关系连接的表的条件在构造 ON 的时候处理
+func (s *Selector[T]) notDeletedWhere(table TableReference, inJoin bool) ([]Predicate, error) {
+	switch t := table.(type) {
+	case nil:
+		if s.model.SoftDelete != nil {
+			return []Predicate{notDeleted("", s.model)}, nil
 		}
-
-		// WHERE (`Age` = ?) AND (`name` = ?)
-		_, ok = exp.right.(Predicate)
-		if ok {
-			s.sb.WriteByte('(')
+	case Table:
+		m, err := s.r.Get(t.entity)
+		if err != nil {
+			return nil, err
 		}
-		if err := s.buildExpression(exp.right); err != nil {
-			return err
+		if m.SoftDelete == nil {
+			return nil, nil
 		}
-		if ok {
-			s.sb.WriteByte(')')
+		// 连接的时候必须加上限定，不然列名会有歧义
+		qualifier := t.alias
+		if qualifier == "" && inJoin {
+			qualifier = m.TableName
 		}
-
-	case Column:
-		// TODO
-		// 忽略别名
-		exp.alias = ""
-		return s.buildColumn(exp)
-
-	// 如果是值，我们就把它添加进s中，然后用占位符表示
-	// 防止SQL注入
-	case value:
-		s.addArgs(exp.val)
-		s.sb.WriteString("?")
-
-	case RawExpr:
-		if len(exp.args) > 0 {
-			s.addArgs(exp.args...)
+		return []Predicate{notDeleted(qualifier, m)}, nil
+	case Join:
+		res, err := s.notDeletedWhere(t.left, true)
+		if err != nil {
+			return nil, err
 		}
-		// 检查是否是聚合函数表达式
-		if isAggregateExpr(exp.raw) {
-			s.sb.WriteString(exp.raw)
-		} else {
-			// 用户自定义的 RawExpr，添加括号保证优先级
-			s.sb.WriteByte('(')
-			s.sb.WriteString(exp.raw)
-			s.sb.WriteByte(')')
+		if t.relation == "" && len(t.on) == 0 {
+			ps, err := s.notDeletedWhere(t.right, true)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, ps...)
 		}
+		return res, nil
+	}
+	return nil, nil
+}
 
-	default:
-		return errs.NewErrUnsupportedExpression(expr)
+// buildRelationOn 构造 `right` ON `left`.`col`=`right`.`col`
+func (s *Selector[T]) buildRelationOn(leftName string, lm *model.Model, leftField string,
+	rm *model.Model, rightField string) error {
+	lfd, err := s.relationField(lm, leftField)
+	if err != nil {
+		return err
+	}
+	rfd, err := s.relationField(rm, rightField)
+	if err != nil {
+		return err
 	}
+	s.quote(rm.TableName)
+	s.sb.WriteString(" ON ")
+	s.buildQualified(leftName, lfd.ColName)
+	s.sb.WriteByte('=')
+	s.buildQualified(rm.TableName, rfd.ColName)
 	return nil
 }
 
+func (s *Selector[T]) relationField(m *model.Model, name string) (*model.Field, error) {
+	fd, ok := m.FieldMap[name]
+	if !ok {
+		return nil, errs.NewErrUnknownField(name)
+	}
+	return fd, nil
+}
+
+// buildQualified 构造 `table`.`col`
+func (s *Selector[T]) buildQualified(table, col string) {
+	s.quote(table)
+	s.sb.WriteByte('.')
+	s.quote(col)
+}
+
 // 判断是否是聚合函数表达式
 func isAggregateExpr(expr string) bool {
 	aggregateFuncs := []string{"COUNT", "SUM", "AVG", "MAX", "MIN"}
@@ -327,13 +467,34 @@ func (s *Selector[T]) Get(ctx context.Context) (*T, error) {
 	if err != nil {
 		return nil, err
 	}
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	// 加锁的查询只能在主库上执行
+	if s.lock != lockNone {
+		ctx = UsePrimary(ctx)
+	}
+	if algo, ok := shardingAlgo[T](s.core); ok {
+		return s.shardingGet(ctx, algo)
+	}
+	return s.get(ctx)
+}
+
+func (s *Selector[T]) get(ctx context.Context) (*T, error) {
+	ctx = withSession(ctx, s.sess)
 	res := get[T](ctx, s.sess, s.core, &QueryContext{
 		Type:    "SELECT",
 		Builder: s,
 		Model:   s.model,
 	})
 	if res.Result != nil {
-		return res.Result.(*T), res.Err
+		t := res.Result.(*T)
+		if res.Err == nil {
+			res.Err = s.afterFind(ctx, t)
+		}
+		return t, res.Err
 	}
 	return nil, res.Err
 }
@@ -361,62 +522,77 @@ func (s *Selector[T]) Get(ctx context.Context) (*T, error) {
 //}
 
 func (s *Selector[T]) GetMulti(ctx context.Context) ([]*T, error) {
-	q, err := s.Build()
+	var err error
+	s.model, err = s.r.Get(new(T))
 	if err != nil {
 		return nil, err
 	}
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	// 加锁的查询只能在主库上执行
+	if s.lock != lockNone {
+		ctx = UsePrimary(ctx)
+	}
+	if algo, ok := shardingAlgo[T](s.core); ok {
+		return s.shardingGetMulti(ctx, algo)
+	}
+	return s.getMulti(ctx)
+}
 
-	rows, err := s.sess.queryContext(ctx, q.SQL, q.Args...)
-	if err != nil {
+func (s *Selector[T]) getMulti(ctx context.Context) ([]*T, error) {
+	ctx = withSession(ctx, s.sess)
+	res := getMulti[T](ctx, s.sess, s.core, &QueryContext{
+		Type:    "SELECT",
+		Builder: s,
+		Model:   s.model,
+	})
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	result, _ := res.Result.([]*T)
+	if err := s.afterFind(ctx, result...); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	// 用来装数据
-	var result []*T
-	for rows.Next() {
-		// 我觉得用户的顺序可能混乱，所以我需要知道用户的查询顺序
-		cs, err := rows.Columns()
-		if err != nil {
-			return nil, err
-		}
+	return result, nil
+}
 
-		vals := make([]any, 0, len(cs))
-		valsElem := make([]reflect.Value, 0, len(cs))
+// Preload 预加载关联，每个关联只会发一次 IN 查询，避免 N+1
+// 支持用 . 表示嵌套的关联，ps 是加载这一层关联时额外的条件
+// 大概用法：NewSelector[User](db).Preload("Orders").Preload("Orders.Items", C("Price").Gt(10))
+func (s *Selector[T]) Preload(path string, ps ...Predicate) *Selector[T] {
+	if s.preloads == nil {
+		s.preloads = &preloadNode{}
+	}
+	s.preloads.add(path, ps)
+	return s
+}
 
-		for _, c := range cs {
-			// 获取的fd就是我们的字段名
-			fd, ok := s.model.ColumnMap[c]
-			if !ok {
-				return nil, errs.NewErrUnknownField(c)
-			}
-			// 返回一个初始化为具体值的新值
-			val := reflect.New(fd.Type)
-			vals = append(vals, val.Interface())
-			// 当你对通过 reflect.New() 创建的值调用 Elem() 时，它返回指针指向的值
-			valsElem = append(valsElem, val.Elem())
+// afterFind 查询出结果之后的处理：先加载关联，再调用 AfterFind 钩子
+func (s *Selector[T]) afterFind(ctx context.Context, res ...*T) error {
+	if s.preloads != nil && len(res) > 0 {
+		parents := make([]reflect.Value, 0, len(res))
+		for _, r := range res {
+			parents = append(parents, reflect.ValueOf(r))
 		}
-		// rows.Scan(vals...) 执行后，valsElem中的这些值会被填充为数据库返回的实际数据。
-		err = rows.Scan(vals...)
-		if err != nil {
-			return nil, err
+		if err := preload(ctx, s.sess, s.core, s.model, parents, s.preloads); err != nil {
+			return err
 		}
-
-		// 获取了顺序之后，我们就需要将获得的数据写入到指定的结构体里
-		tp := new(T)
-		// 获取用户传入的结构体
-		tpValue := reflect.ValueOf(tp)
-		for k, c := range cs {
-			fd, ok := s.model.ColumnMap[c]
-			if !ok {
-				return nil, errs.NewErrUnknownField(c)
-			}
-
-			tpValue.Elem().FieldByName(fd.GoName).Set(valsElem[k])
+	}
+	for _, r := range res {
+		if err := afterFind(ctx, r); err != nil {
+			return err
 		}
-		result = append(result, tp)
 	}
-	return result, nil
+	return nil
+}
+
+// Unscoped 查询的时候不过滤软删除的数据
+func (s *Selector[T]) Unscoped() *Selector[T] {
+	s.unscoped = true
+	return s
 }
 
 // GroupBy 设置 GROUP BY 子句
@@ -430,3 +606,68 @@ func (s *Selector[T]) Having(ps ...Predicate) *Selector[T] {
 	s.having = ps
 	return s
 }
+
+// OrderBy 设置 ORDER BY 子句
+// 大概用法：OrderBy(Asc("Id"), Desc("Age"))
+func (s *Selector[T]) OrderBy(bys ...OrderBy) *Selector[T] {
+	s.orderBy = bys
+	return s
+}
+
+// Limit 设置 LIMIT，小于等于 0 表示不限制
+func (s *Selector[T]) Limit(limit int) *Selector[T] {
+	s.limit = limit
+	return s
+}
+
+// Offset 设置 OFFSET
+func (s *Selector[T]) Offset(offset int) *Selector[T] {
+	s.offset = offset
+	return s
+}
+
+// ForUpdate 加上 FOR UPDATE，只在事务里面有意义
+// 不支持行锁的方言，例如 SQLite，会忽略它
+func (s *Selector[T]) ForUpdate() *Selector[T] {
+	if s.lock == lockNone {
+		s.lock = lockForUpdate
+	}
+	return s
+}
+
+// Timeout 限制这条查询的执行时间，包括预加载关联的查询，
+// 超时之后返回 ErrQueryTimeout。
+// MySQL 还会加上 MAX_EXECUTION_TIME 提示，让数据库那边也能及时停下来
+func (s *Selector[T]) Timeout(d time.Duration) *Selector[T] {
+	s.timeout = d
+	return s
+}
+
+// SkipLocked 加上 FOR UPDATE SKIP LOCKED，跳过已经被别的事务锁住的行
+func (s *Selector[T]) SkipLocked() *Selector[T] {
+	s.lock = lockSkipLocked
+	return s
+}
+
+type OrderBy struct {
+	col   Column
+	order string
+}
+
+// Asc 升序
+func Asc(col string) OrderBy {
+	return OrderBy{col: C(col), order: "ASC"}
+}
+
+// Desc 降序
+func Desc(col string) OrderBy {
+	return OrderBy{col: C(col), order: "DESC"}
+}
+
+type lockMode uint8
+
+const (
+	lockNone lockMode = iota
+	lockForUpdate
+	lockSkipLocked
+)
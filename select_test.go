@@ -3,9 +3,13 @@ package orm
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
+	"web/orm/internal/errs"
 	"web/orm/internal/valuer"
 	"web/orm/model"
 )
@@ -185,6 +189,166 @@ func TestSelector_GetMulti(t *testing.T) {
 	}
 }
 
+func TestSelector_JoinRelation(t *testing.T) {
+	db := &DB{
+		core: core{
+			r:       model.NewRegistry(),
+			dialect: DialectMySOL,
+			creator: valuer.NewReflectValue,
+		},
+	}
+	testCases := []struct {
+		name      string
+		builder   QueryBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name:    "has many",
+			builder: NewSelector[RelUser](db).From(TableOf(&RelUser{}).JoinRelation("Orders")),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM (`rel_user` JOIN `rel_order` ON `rel_user`.`id`=`rel_order`.`rel_user_id`);",
+			},
+		},
+		{
+			name: "belongs to with alias",
+			builder: NewSelector[RelOrder](db).
+				From(TableOf(&RelOrder{}).As("o").LeftJoinRelation("User")),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM (`rel_order` AS `o` LEFT JOIN `rel_user` ON `o`.`user_id`=`rel_user`.`id`);",
+			},
+		},
+		{
+			name:    "many to many",
+			builder: NewSelector[RelUser](db).From(TableOf(&RelUser{}).JoinRelation("Roles")),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM (`rel_user` JOIN `user_role` ON `rel_user`.`id`=`user_role`.`rel_user_id`" +
+					" JOIN `rel_role` ON `user_role`.`rel_role_id`=`rel_role`.`id`);",
+			},
+		},
+		{
+			name:    "many to many target refs",
+			builder: NewSelector[RelCodeUser](db).From(TableOf(&RelCodeUser{}).JoinRelation("Roles")),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM (`rel_code_user` JOIN `user_role` ON `rel_code_user`.`id`=`user_role`.`rel_code_user_id`" +
+					" JOIN `rel_role` ON `user_role`.`role_code`=`rel_role`.`code`);",
+			},
+		},
+		{
+			name:    "unknown relation",
+			builder: NewSelector[RelUser](db).From(TableOf(&RelUser{}).JoinRelation("Invalid")),
+			wantErr: errs.NewErrUnknownRelation("Invalid"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := tc.builder.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, q)
+		})
+	}
+}
+
+func TestSelector_SoftDelete(t *testing.T) {
+	db := &DB{
+		core: core{
+			r:       model.NewRegistry(),
+			dialect: DialectMySOL,
+			creator: valuer.NewReflectValue,
+		},
+	}
+	testCases := []struct {
+		name      string
+		builder   QueryBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name:    "where",
+			builder: NewSelector[SoftDeleteTimeModel](db).Where(C("Id").Eq(12)),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `soft_delete_time_model` WHERE (`id` = ?) AND (`deleted_at` IS NULL);",
+				Args: []any{12},
+			},
+		},
+		{
+			name:    "flag",
+			builder: NewSelector[SoftDeleteModel](db),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `soft_delete_model` WHERE `deleted` = ?;",
+				Args: []any{false},
+			},
+		},
+		{
+			name:    "unscoped",
+			builder: NewSelector[SoftDeleteModel](db).Unscoped(),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM `soft_delete_model`;",
+			},
+		},
+		{
+			name: "join",
+			builder: NewSelector[SoftDeleteModel](db).From(
+				TableOf(&SoftDeleteModel{}).As("m").LeftJoin(TableOf(&SoftDeleteTimeModel{})).
+					On(TableOf(&SoftDeleteModel{}).As("m").C("Id").Eq(TableOf(&SoftDeleteTimeModel{}).C("Id")))),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM (`soft_delete_model` AS `m` LEFT JOIN `soft_delete_time_model`)" +
+					" ON (`m`.`id` = `id`) AND (`soft_delete_time_model`.`deleted_at` IS NULL) WHERE `m`.`deleted` = ?;",
+				Args: []any{false},
+			},
+		},
+		{
+			// 没有连接条件，被连接的表的条件只能放在 WHERE 里面
+			name: "join without condition",
+			builder: NewSelector[SoftDeleteModel](db).From(
+				TableOf(&SoftDeleteModel{}).As("m").Join(TableOf(&SoftDeleteTimeModel{})).On()),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM (`soft_delete_model` AS `m` JOIN `soft_delete_time_model`)" +
+					" WHERE (`m`.`deleted` = ?) AND (`soft_delete_time_model`.`deleted_at` IS NULL);",
+				Args: []any{false},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := tc.builder.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, q)
+		})
+	}
+}
+
+type RelUser struct {
+	Id     int64
+	Orders []*RelOrder `orm:"rel=has_many"`
+	Roles  []*RelRole  `orm:"rel=many_to_many,join_table=user_role"`
+}
+
+type RelOrder struct {
+	Id        int64
+	RelUserId int64
+	UserId    int64
+	User      *RelUser `orm:"rel=belongs_to"`
+}
+
+type RelCodeUser struct {
+	Id    int64
+	Roles []*RelRole `orm:"rel=many_to_many,join_table=user_role,join_refs=role_code,target_refs=Code"`
+}
+
+type RelRole struct {
+	Id   int64
+	Code string
+}
+
 type TestModel struct {
 	Id        int64
 	FirstName string
@@ -310,3 +474,184 @@ func TestSelector_Having(t *testing.T) {
 		})
 	}
 }
+
+func TestSelector_OrderByLimit(t *testing.T) {
+	r := &DB{
+		core: core{
+			r:       model.NewRegistry(),
+			dialect: DialectMySOL,
+			creator: valuer.NewReflectValue,
+		},
+	}
+	sqlite := &DB{
+		core: core{
+			r:       model.NewRegistry(),
+			dialect: DialectSQLite,
+			creator: valuer.NewReflectValue,
+		},
+	}
+	testCases := []struct {
+		name      string
+		q         QueryBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name: "order by",
+			q:    NewSelector[TestModel](r).OrderBy(Asc("Age"), Desc("Id")),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM `test_model` ORDER BY `age` ASC,`id` DESC;",
+			},
+		},
+		{
+			name:    "order by unknown field",
+			q:       NewSelector[TestModel](r).OrderBy(Asc("Invalid")),
+			wantErr: errs.NewErrUnknownField("Invalid"),
+		},
+		{
+			name: "limit offset",
+			q:    NewSelector[TestModel](r).Where(C("Age").Gt(18)).Limit(10).Offset(20),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE `age` > ? LIMIT ? OFFSET ?;",
+				Args: []any{18, 10, 20},
+			},
+		},
+		{
+			name: "for update",
+			q:    NewSelector[TestModel](r).Where(C("Id").Eq(1)).ForUpdate(),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE `id` = ? FOR UPDATE;",
+				Args: []any{1},
+			},
+		},
+		{
+			name: "skip locked",
+			q:    NewSelector[TestModel](r).OrderBy(Asc("Id")).Limit(10).SkipLocked(),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` ORDER BY `id` ASC LIMIT ? FOR UPDATE SKIP LOCKED;",
+				Args: []any{10},
+			},
+		},
+		{
+			// SQLite 没有行锁
+			name: "sqlite skip locked",
+			q:    NewSelector[TestModel](sqlite).Limit(10).SkipLocked(),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` LIMIT ?;",
+				Args: []any{10},
+			},
+		},
+		{
+			name: "timeout",
+			q:    NewSelector[TestModel](r).Where(C("Id").Eq(1)).Timeout(1500 * time.Millisecond),
+			wantQuery: &Query{
+				SQL:  "SELECT /*+ MAX_EXECUTION_TIME(1500) */ * FROM `test_model` WHERE `id` = ?;",
+				Args: []any{1},
+			},
+		},
+		{
+			// SQLite 只依赖 context 超时
+			name: "sqlite timeout",
+			q:    NewSelector[TestModel](sqlite).Where(C("Id").Eq(1)).Timeout(time.Second),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE `id` = ?;",
+				Args: []any{1},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := tc.q.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, query)
+		})
+	}
+}
+
+func TestSelector_Timeout(t *testing.T) {
+	testCases := []struct {
+		name    string
+		timeout time.Duration
+		mock    func(mock sqlmock.Sqlmock)
+		ctx     func() (context.Context, context.CancelFunc)
+		// get 为 true 的时候用 Get，否则用 GetMulti
+		get bool
+		// wantTimeout 为 false 的时候错误不应该是 ErrQueryTimeout
+		wantTimeout bool
+		wantErr     error
+	}{
+		{
+			name:    "client timeout",
+			timeout: 10 * time.Millisecond,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .*").WillDelayFor(time.Second).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+			wantTimeout: true,
+			wantErr:     context.DeadlineExceeded,
+		},
+		{
+			name:    "server timeout",
+			timeout: time.Second,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .*").WillReturnError(mysqlNumberError(3024))
+			},
+			wantTimeout: true,
+		},
+		{
+			// 读第一行的时候才超时，rows.Next 返回 false，不能当成没有数据
+			name:    "get row timeout",
+			timeout: time.Second,
+			get:     true,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id"}).
+					AddRow(1).RowError(0, context.DeadlineExceeded))
+			},
+			wantTimeout: true,
+			wantErr:     context.DeadlineExceeded,
+		},
+		{
+			name: "canceled",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .*").WillDelayFor(time.Second).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(10*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer mockDB.Close()
+			db, err := OpenDB(mockDB)
+			require.NoError(t, err)
+			tc.mock(mock)
+
+			ctx, cancel := context.Background(), context.CancelFunc(func() {})
+			if tc.ctx != nil {
+				ctx, cancel = tc.ctx()
+			}
+			defer cancel()
+			s := NewSelector[TestModel](db).Timeout(tc.timeout)
+			if tc.get {
+				_, err = s.Get(ctx)
+			} else {
+				_, err = s.GetMulti(ctx)
+			}
+			assert.Equal(t, tc.wantTimeout, errors.Is(err, ErrQueryTimeout), err)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			}
+		})
+	}
+}
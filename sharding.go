@@ -0,0 +1,430 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"web/orm/internal/errs"
+	"web/orm/model"
+)
+
+// Shard 分片的目标
+type Shard struct {
+	// DB 目标库的名字，对应 DBWithShards 里面的 key，为空表示 DB 本身
+	DB string
+	// Table 目标表
+	Table string
+}
+
+// ShardingAlgorithm 分片算法
+type ShardingAlgorithm interface {
+	// ShardingKey 分片键的字段名
+	ShardingKey() string
+	// Sharding 分片键的值对应的目标
+	Sharding(val any) (Shard, error)
+	// Broadcast 所有的目标，条件里面没有分片键的时候会查询所有的目标
+	Broadcast() []Shard
+}
+
+type sharding struct {
+	dbs   map[string]*DB
+	algos map[reflect.Type]ShardingAlgorithm
+}
+
+func (c *core) initSharding() {
+	if c.sharding == nil {
+		c.sharding = &sharding{
+			dbs:   map[string]*DB{},
+			algos: map[reflect.Type]ShardingAlgorithm{},
+		}
+	}
+}
+
+// DBWithShards 登记分库，key 是 Shard.DB 里面用的名字
+func DBWithShards(dbs map[string]*DB) DBOption {
+	return func(db *DB) {
+		db.initSharding()
+		for name, d := range dbs {
+			db.sharding.dbs[name] = d
+		}
+	}
+}
+
+// DBWithSharding 给模型指定分片算法
+// 之后 Selector、Inserter、Updater 和 Deleter 会按照分片键把语句发到对应的库和表，
+// 条件里面没有分片键的时候会发到所有的库和表，再合并结果
+func DBWithSharding(entity any, algo ShardingAlgorithm) DBOption {
+	return func(db *DB) {
+		db.initSharding()
+		db.sharding.algos[shardingType(reflect.TypeOf(entity))] = algo
+	}
+}
+
+func shardingType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// shardingAlgo 拿到 T 对应的分片算法
+func shardingAlgo[T any](c core) (ShardingAlgorithm, bool) {
+	if c.sharding == nil {
+		return nil, false
+	}
+	algo, ok := c.sharding.algos[shardingType(reflect.TypeOf(new(T)))]
+	return algo, ok
+}
+
+// session 分片对应的 Session
+// 分片没法在一个事务里面完成，所以 sess 是事务的时候直接返回错误
+func (s *sharding) session(sess Session, shard Shard) (Session, error) {
+	switch sess.(type) {
+	case *DB, *Cluster:
+	default:
+		return nil, errs.ErrShardingInTx
+	}
+	if shard.DB == "" {
+		return sess, nil
+	}
+	res, ok := s.dbs[shard.DB]
+	if !ok {
+		return nil, errs.NewErrUnknownShardDB(shard.DB)
+	}
+	return res, nil
+}
+
+// shardModel 把元数据里面的表名换成分片的表名
+func shardModel(m *model.Model, shard Shard) *model.Model {
+	if shard.Table == "" {
+		return m
+	}
+	res := *m
+	res.TableName = shard.Table
+	return &res
+}
+
+// shardsOf 根据查询条件计算需要查询的分片
+func shardsOf(algo ShardingAlgorithm, where []Predicate) ([]Shard, error) {
+	if len(where) == 0 {
+		return algo.Broadcast(), nil
+	}
+	p := where[0]
+	for _, w := range where[1:] {
+		p = p.And(w)
+	}
+	shards, all, err := shardsOfPredicate(algo, p)
+	if err != nil || all {
+		return algo.Broadcast(), err
+	}
+	return shards, nil
+}
+
+// shardsOfPredicate all 为 true 表示没有办法确定分片，需要查询所有的分片
+func shardsOfPredicate(algo ShardingAlgorithm, p Predicate) (shards []Shard, all bool, err error) {
+	switch p.op {
+	case opAnd, opOr:
+		left, ok := p.left.(Predicate)
+		right, ok2 := p.right.(Predicate)
+		if !ok || !ok2 {
+			return nil, true, nil
+		}
+		ls, lAll, err := shardsOfPredicate(algo, left)
+		if err != nil {
+			return nil, false, err
+		}
+		rs, rAll, err := shardsOfPredicate(algo, right)
+		if err != nil {
+			return nil, false, err
+		}
+		if p.op == opOr {
+			if lAll || rAll {
+				return nil, true, nil
+			}
+			return mergeShards(ls, rs), false, nil
+		}
+		switch {
+		case lAll:
+			return rs, rAll, nil
+		case rAll:
+			return ls, false, nil
+		}
+		return intersectShards(ls, rs), false, nil
+	case opEq, opIn:
+		col, ok := p.left.(Column)
+		if !ok || col.name != algo.ShardingKey() {
+			return nil, true, nil
+		}
+		var vals []any
+		switch v := p.right.(type) {
+		case value:
+			vals = []any{v.val}
+		case values:
+			vals = v.vals
+		default:
+			return nil, true, nil
+		}
+		for _, val := range vals {
+			shard, err := algo.Sharding(val)
+			if err != nil {
+				return nil, false, err
+			}
+			shards = mergeShards(shards, []Shard{shard})
+		}
+		return shards, false, nil
+	}
+	return nil, true, nil
+}
+
+// mergeShards 并集，保持原本的顺序
+func mergeShards(a, b []Shard) []Shard {
+	res := append([]Shard{}, a...)
+	for _, s := range b {
+		if !containsShard(res, s) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func intersectShards(a, b []Shard) []Shard {
+	res := make([]Shard, 0, len(a))
+	for _, s := range a {
+		if containsShard(b, s) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func containsShard(shards []Shard, s Shard) bool {
+	for _, shard := range shards {
+		if shard == s {
+			return true
+		}
+	}
+	return false
+}
+
+// HashSharding 按照分片键取模，分片键必须是整数
+// 库的下标是 key % DBCount，表的下标是 key / DBCount % TableCount，
+// 例如 DBCount 为 4，TableCount 为 2 的时候，UserId 为 6 的数据在 db_2.order_1 上面
+type HashSharding struct {
+	Key string
+	// DBPattern 例如 db_%d，为空表示不分库
+	DBPattern string
+	DBCount   int
+	// TablePattern 例如 order_%d，为空表示不分表
+	TablePattern string
+	TableCount   int
+}
+
+func (h HashSharding) ShardingKey() string {
+	return h.Key
+}
+
+func (h HashSharding) Sharding(val any) (Shard, error) {
+	key, ok := shardingInt(val)
+	if !ok || key < 0 {
+		return Shard{}, errs.NewErrInvalidShardingKey(h.Key, val)
+	}
+	dbCnt, tableCnt := max(h.DBCount, 1), max(h.TableCount, 1)
+	return h.shard(key%int64(dbCnt), key/int64(dbCnt)%int64(tableCnt)), nil
+}
+
+func (h HashSharding) Broadcast() []Shard {
+	dbCnt, tableCnt := max(h.DBCount, 1), max(h.TableCount, 1)
+	res := make([]Shard, 0, dbCnt*tableCnt)
+	for i := 0; i < dbCnt; i++ {
+		for j := 0; j < tableCnt; j++ {
+			res = append(res, h.shard(int64(i), int64(j)))
+		}
+	}
+	return res
+}
+
+func (h HashSharding) shard(db, table int64) Shard {
+	var res Shard
+	if h.DBPattern != "" {
+		res.DB = fmt.Sprintf(h.DBPattern, db)
+	}
+	if h.TablePattern != "" {
+		res.Table = fmt.Sprintf(h.TablePattern, table)
+	}
+	return res
+}
+
+// ShardRange 范围分片里面的一段，分片键小于 Max 并且不属于前面的段的数据在 Shard 上
+type ShardRange struct {
+	Max   int64
+	Shard Shard
+}
+
+// RangeSharding 按照分片键的范围分片，Ranges 需要按照 Max 升序排列
+type RangeSharding struct {
+	Key    string
+	Ranges []ShardRange
+}
+
+func (r RangeSharding) ShardingKey() string {
+	return r.Key
+}
+
+func (r RangeSharding) Sharding(val any) (Shard, error) {
+	key, ok := shardingInt(val)
+	if ok {
+		for _, rg := range r.Ranges {
+			if key < rg.Max {
+				return rg.Shard, nil
+			}
+		}
+	}
+	return Shard{}, errs.NewErrInvalidShardingKey(r.Key, val)
+}
+
+func (r RangeSharding) Broadcast() []Shard {
+	var res []Shard
+	for _, rg := range r.Ranges {
+		res = mergeShards(res, []Shard{rg.Shard})
+	}
+	return res
+}
+
+func shardingInt(val any) (int64, bool) {
+	rv := reflect.ValueOf(val)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch {
+	case rv.CanInt():
+		return rv.Int(), true
+	case rv.CanUint():
+		return int64(rv.Uint()), true
+	}
+	return 0, false
+}
+
+// shardingResult 多个分片的执行结果
+type shardingResult []sql.Result
+
+func (r shardingResult) LastInsertId() (int64, error) {
+	if len(r) != 1 {
+		return 0, errs.NewErrShardingUnsupported("在多个分片上获取 LastInsertId")
+	}
+	return r[0].LastInsertId()
+}
+
+func (r shardingResult) RowsAffected() (int64, error) {
+	var res int64
+	for _, sr := range r {
+		affected, err := sr.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		res += affected
+	}
+	return res, nil
+}
+
+// sortByOrder 多个分片的结果合并之后在内存里面排序
+func sortByOrder[T any](res []*T, m *model.Model, bys []OrderBy) error {
+	for _, by := range bys {
+		if _, ok := m.FieldMap[by.col.name]; !ok {
+			return errs.NewErrUnknownField(by.col.name)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		vi, vj := reflect.ValueOf(res[i]).Elem(), reflect.ValueOf(res[j]).Elem()
+		for _, by := range bys {
+			c := compareValue(vi.FieldByName(by.col.name), vj.FieldByName(by.col.name))
+			if c == 0 {
+				continue
+			}
+			if by.order == "DESC" {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return nil
+}
+
+// compareValue 比较两个字段的值，nil 排在最前面
+func compareValue(a, b reflect.Value) int {
+	for a.Kind() == reflect.Ptr || b.Kind() == reflect.Ptr {
+		switch {
+		case a.IsNil() && b.IsNil():
+			return 0
+		case a.IsNil():
+			return -1
+		case b.IsNil():
+			return 1
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+	switch {
+	case a.CanInt():
+		return cmpOrdered(a.Int(), b.Int())
+	case a.CanUint():
+		return cmpOrdered(a.Uint(), b.Uint())
+	case a.CanFloat():
+		return cmpOrdered(a.Float(), b.Float())
+	case a.Kind() == reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case a.Kind() == reflect.Bool:
+		return cmpOrdered(boolInt(a.Bool()), boolInt(b.Bool()))
+	}
+	if ta, ok := a.Interface().(time.Time); ok {
+		return ta.Compare(b.Interface().(time.Time))
+	}
+	return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+}
+
+func cmpOrdered[T int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// shardQuery 发到某个分片上的语句
+type shardQuery struct {
+	sess    Session
+	core    core
+	builder QueryBuilder
+}
+
+// execShards 依次在每个分片上执行，遇到错误就停下来
+// 跨库没有办法保证原子性，已经执行成功的分片不会回滚
+func execShards(ctx context.Context, typ string, qs []shardQuery) *QueryResult {
+	res := make(shardingResult, 0, len(qs))
+	for _, q := range qs {
+		r := exec(ctx, q.sess, q.core, &QueryContext{
+			Type:    typ,
+			Builder: q.builder,
+			Model:   q.core.model,
+		})
+		if r.Err != nil {
+			return &QueryResult{Err: r.Err}
+		}
+		if sr, ok := r.Result.(sql.Result); ok {
+			res = append(res, sr)
+		}
+	}
+	return &QueryResult{Result: res}
+}
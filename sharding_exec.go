@@ -0,0 +1,115 @@
+package orm
+
+import (
+	"context"
+	"reflect"
+	"web/orm/internal/errs"
+)
+
+// shardingExec 按照每一行的分片键分组，每个分片插入一次
+func (i *Inserter[T]) shardingExec(ctx context.Context, algo ShardingAlgorithm) *QueryResult {
+	key := algo.ShardingKey()
+	if _, ok := i.model.FieldMap[key]; !ok {
+		return &QueryResult{Err: errs.NewErrUnknownField(key)}
+	}
+	var shards []Shard
+	grouped := make(map[Shard][]*T, 4)
+	for _, v := range i.values {
+		shard, err := algo.Sharding(reflect.ValueOf(v).Elem().FieldByName(key).Interface())
+		if err != nil {
+			return &QueryResult{Err: err}
+		}
+		if _, ok := grouped[shard]; !ok {
+			shards = append(shards, shard)
+		}
+		grouped[shard] = append(grouped[shard], v)
+	}
+	qs := make([]shardQuery, 0, len(shards))
+	for _, shard := range shards {
+		sess, err := i.core.sharding.session(i.sess, shard)
+		if err != nil {
+			return &QueryResult{Err: err}
+		}
+		sub := &Inserter[T]{
+			values:         grouped[shard],
+			columns:        i.columns,
+			builder:        builder{core: i.core, quoter: i.quoter},
+			sess:           sess,
+			onDuplicateKey: i.onDuplicateKey,
+		}
+		sub.model = shardModel(i.model, shard)
+		qs = append(qs, shardQuery{sess: sess, core: sub.core, builder: sub})
+	}
+	return execShards(ctx, "INSERT", qs)
+}
+
+// shardingExec 按照条件找到分片，没有分片键的时候会在所有的分片上删除
+func (d *Deleter[T]) shardingExec(ctx context.Context, algo ShardingAlgorithm) *QueryResult {
+	if d.table != "" {
+		return &QueryResult{Err: errs.NewErrShardingUnsupported("指定表")}
+	}
+	if len(d.where) == 0 {
+		return &QueryResult{Err: errs.ErrDeleteALL}
+	}
+	shards, err := shardsOf(algo, d.where)
+	if err != nil {
+		return &QueryResult{Err: err}
+	}
+	qs := make([]shardQuery, 0, len(shards))
+	for _, shard := range shards {
+		sess, err := d.core.sharding.session(d.sess, shard)
+		if err != nil {
+			return &QueryResult{Err: err}
+		}
+		// Deleter 每次构造的时候都会重新解析元数据，所以分表用 table 指定
+		sub := &Deleter[T]{
+			builder: builder{core: d.core, quoter: d.quoter},
+			table:   shard.Table,
+			where:   d.where,
+			sess:    sess,
+			hard:    d.hard,
+		}
+		sub.model = d.model
+		qs = append(qs, shardQuery{sess: sess, core: sub.core, builder: sub})
+	}
+	return execShards(ctx, "DELETE", qs)
+}
+
+// shardingExec 按照条件找到分片，有实体的时候以实体上的分片键为准
+func (u *Updater[T]) shardingExec(ctx context.Context, algo ShardingAlgorithm) *QueryResult {
+	var shards []Shard
+	if u.val != nil {
+		key := algo.ShardingKey()
+		if _, ok := u.model.FieldMap[key]; !ok {
+			return &QueryResult{Err: errs.NewErrUnknownField(key)}
+		}
+		shard, err := algo.Sharding(reflect.ValueOf(u.val).Elem().FieldByName(key).Interface())
+		if err != nil {
+			return &QueryResult{Err: err}
+		}
+		shards = []Shard{shard}
+	} else {
+		var err error
+		shards, err = shardsOf(algo, u.where)
+		if err != nil {
+			return &QueryResult{Err: err}
+		}
+	}
+	qs := make([]shardQuery, 0, len(shards))
+	for _, shard := range shards {
+		sess, err := u.core.sharding.session(u.sess, shard)
+		if err != nil {
+			return &QueryResult{Err: err}
+		}
+		sub := &Updater[T]{
+			builder: builder{core: u.core, quoter: u.quoter},
+			val:     u.val,
+			assigns: u.assigns,
+			where:   u.where,
+			sess:    sess,
+		}
+		sub.model = shardModel(u.model, shard)
+		qs = append(qs, shardQuery{sess: sess, core: sub.core, builder: sub})
+	}
+	return execShards(ctx, "UPDATE", qs)
+}
@@ -0,0 +1,121 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"web/orm/internal/errs"
+)
+
+// shardSelector 复制一份 Selector 发到某个分片上
+// 整个复制，这样 GROUP BY、HAVING、超时这些设置都会带过去，只替换 builder、元数据和 Session
+func (s *Selector[T]) shardSelector(shard Shard) (*Selector[T], error) {
+	sess, err := s.core.sharding.session(s.sess, shard)
+	if err != nil {
+		return nil, err
+	}
+	res := *s
+	res.builder = builder{core: s.core, quoter: s.quoter}
+	res.model = shardModel(s.model, shard)
+	res.sess = sess
+	return &res, nil
+}
+
+// checkSharding 跨分片的时候只能做简单的合并，所以不支持联表、分组以及聚合函数
+func (s *Selector[T]) checkSharding(shards []Shard) error {
+	if s.table != nil {
+		return errs.NewErrShardingUnsupported("指定表")
+	}
+	if len(shards) <= 1 {
+		return nil
+	}
+	if len(s.groupBy) > 0 || len(s.having) > 0 {
+		return errs.NewErrShardingUnsupported("跨分片的 GROUP BY")
+	}
+	for _, col := range s.columns {
+		if _, ok := col.(Column); !ok {
+			return errs.NewErrShardingUnsupported("跨分片的聚合函数")
+		}
+	}
+	return nil
+}
+
+func (s *Selector[T]) shardingGet(ctx context.Context, algo ShardingAlgorithm) (*T, error) {
+	shards, err := shardsOf(algo, s.where)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkSharding(shards); err != nil {
+		return nil, err
+	}
+	if len(shards) == 1 {
+		sub, err := s.shardSelector(shards[0])
+		if err != nil {
+			return nil, err
+		}
+		return sub.get(ctx)
+	}
+	var res []*T
+	for _, shard := range shards {
+		sub, err := s.shardSelector(shard)
+		if err != nil {
+			return nil, err
+		}
+		t, err := sub.get(ctx)
+		if errors.Is(err, ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	if len(res) == 0 {
+		return nil, ErrNoRows
+	}
+	if err = sortByOrder(res, s.model, s.orderBy); err != nil {
+		return nil, err
+	}
+	return res[0], nil
+}
+
+// shardingGetMulti 每个分片都查 offset + limit 条数据，合并排序之后再截取
+func (s *Selector[T]) shardingGetMulti(ctx context.Context, algo ShardingAlgorithm) ([]*T, error) {
+	shards, err := shardsOf(algo, s.where)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkSharding(shards); err != nil {
+		return nil, err
+	}
+	var res []*T
+	for _, shard := range shards {
+		sub, err := s.shardSelector(shard)
+		if err != nil {
+			return nil, err
+		}
+		if len(shards) > 1 {
+			if sub.limit > 0 {
+				sub.limit += sub.offset
+			}
+			sub.offset = 0
+		}
+		ts, err := sub.getMulti(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ts...)
+	}
+	if len(shards) <= 1 {
+		return res, nil
+	}
+	if err = sortByOrder(res, s.model, s.orderBy); err != nil {
+		return nil, err
+	}
+	if s.offset > 0 {
+		res = res[min(s.offset, len(res)):]
+	}
+	if s.limit > 0 && len(res) > s.limit {
+		res = res[:s.limit]
+	}
+	return res, nil
+}
@@ -0,0 +1,232 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+	"time"
+	"web/orm/internal/errs"
+)
+
+func TestHashSharding(t *testing.T) {
+	algo := HashSharding{
+		Key:          "UserId",
+		DBPattern:    "db_%d",
+		DBCount:      4,
+		TablePattern: "order_%d",
+		TableCount:   2,
+	}
+	shard, err := algo.Sharding(int64(6))
+	require.NoError(t, err)
+	assert.Equal(t, Shard{DB: "db_2", Table: "order_1"}, shard)
+	_, err = algo.Sharding("6")
+	assert.Equal(t, errs.NewErrInvalidShardingKey("UserId", "6"), err)
+	assert.Len(t, algo.Broadcast(), 8)
+
+	// 只分表
+	algo = HashSharding{Key: "UserId", TablePattern: "order_%d", TableCount: 2}
+	shard, err = algo.Sharding(uint8(3))
+	require.NoError(t, err)
+	assert.Equal(t, Shard{Table: "order_1"}, shard)
+	assert.Equal(t, []Shard{{Table: "order_0"}, {Table: "order_1"}}, algo.Broadcast())
+}
+
+func TestRangeSharding(t *testing.T) {
+	algo := RangeSharding{
+		Key: "Id",
+		Ranges: []ShardRange{
+			{Max: 100, Shard: Shard{Table: "order_0"}},
+			{Max: 200, Shard: Shard{Table: "order_1"}},
+			{Max: 300, Shard: Shard{Table: "order_1"}},
+		},
+	}
+	shard, err := algo.Sharding(150)
+	require.NoError(t, err)
+	assert.Equal(t, Shard{Table: "order_1"}, shard)
+	_, err = algo.Sharding(300)
+	assert.Equal(t, errs.NewErrInvalidShardingKey("Id", 300), err)
+	assert.Equal(t, []Shard{{Table: "order_0"}, {Table: "order_1"}}, algo.Broadcast())
+}
+
+func TestShardsOf(t *testing.T) {
+	algo := HashSharding{Key: "UserId", TablePattern: "order_%d", TableCount: 4}
+	all := algo.Broadcast()
+	testCases := []struct {
+		name       string
+		where      []Predicate
+		wantShards []Shard
+	}{
+		{
+			name:       "no where",
+			wantShards: all,
+		},
+		{
+			name:       "eq",
+			where:      []Predicate{C("UserId").Eq(1), C("Id").Gt(10)},
+			wantShards: []Shard{{Table: "order_1"}},
+		},
+		{
+			name:       "in",
+			where:      []Predicate{C("UserId").In(1, 5, 2)},
+			wantShards: []Shard{{Table: "order_1"}, {Table: "order_2"}},
+		},
+		{
+			name:       "or",
+			where:      []Predicate{C("UserId").Eq(1).Or(C("UserId").Eq(3))},
+			wantShards: []Shard{{Table: "order_1"}, {Table: "order_3"}},
+		},
+		{
+			name:       "or without key",
+			where:      []Predicate{C("UserId").Eq(1).Or(C("Id").Eq(3))},
+			wantShards: all,
+		},
+		{
+			name:       "and",
+			where:      []Predicate{C("UserId").In(1, 2), C("UserId").In(2, 3)},
+			wantShards: []Shard{{Table: "order_2"}},
+		},
+		{
+			name:       "not",
+			where:      []Predicate{Not(C("UserId").Eq(1))},
+			wantShards: all,
+		},
+		{
+			name:       "other column",
+			where:      []Predicate{C("Id").Eq(1)},
+			wantShards: all,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			shards, err := shardsOf(algo, tc.where)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantShards, shards)
+		})
+	}
+}
+
+func TestSharding(t *testing.T) {
+	mockDBs := make(map[string]sqlmock.Sqlmock, 2)
+	dbs := make(map[string]*DB, 2)
+	for _, name := range []string{"db_0", "db_1"} {
+		mockDB, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer mockDB.Close()
+		mockDBs[name] = mock
+		dbs[name], err = OpenDB(mockDB)
+		require.NoError(t, err)
+	}
+	mainDB, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mainDB.Close()
+	db, err := OpenDB(mainDB, DBWithShards(dbs), DBWithSharding(&ShardOrder{}, HashSharding{
+		Key:          "UserId",
+		DBPattern:    "db_%d",
+		DBCount:      2,
+		TablePattern: "order_%d",
+		TableCount:   2,
+	}))
+	require.NoError(t, err)
+	ctx := context.Background()
+	db0, db1 := mockDBs["db_0"], mockDBs["db_1"]
+	cols := []string{"id", "user_id", "amount"}
+
+	// 有分片键的时候只查一个分片
+	db1.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `order_1` WHERE `user_id` = ?;")).
+		WithArgs(3).WillReturnRows(sqlmock.NewRows(cols).AddRow(1, 3, 10))
+	res, err := NewSelector[ShardOrder](db).Where(C("UserId").Eq(3)).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*ShardOrder{{Id: 1, UserId: 3, Amount: 10}}, res)
+
+	// 只有一个分片的时候 GROUP BY、HAVING 和超时的提示都要带上
+	db1.ExpectQuery(regexp.QuoteMeta("SELECT /*+ MAX_EXECUTION_TIME(1000) */ `amount` FROM `order_1`"+
+		" WHERE `user_id` = ? GROUP BY `amount` HAVING COUNT(`id`) > ?;")).
+		WithArgs(3, 1).WillReturnRows(sqlmock.NewRows([]string{"amount"}).AddRow(10))
+	res, err = NewSelector[ShardOrder](db).Selectable(C("Amount")).Where(C("UserId").Eq(3)).
+		GroupBy(C("Amount")).Having(Count("Id").Gt(1)).Timeout(time.Second).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*ShardOrder{{Amount: 10}}, res)
+
+	// 没有分片键的时候查所有的分片，合并之后排序分页
+	listSQL := "SELECT * FROM `%s` WHERE `amount` > ? ORDER BY `id` DESC LIMIT ?;"
+	db0.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf(listSQL, "order_0"))).WithArgs(0, 3).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(8, 0, 1).AddRow(4, 0, 1))
+	db0.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf(listSQL, "order_1"))).WithArgs(0, 3).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(6, 2, 1))
+	db1.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf(listSQL, "order_0"))).WithArgs(0, 3).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(7, 1, 1).AddRow(5, 1, 1).AddRow(1, 1, 1))
+	db1.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf(listSQL, "order_1"))).WithArgs(0, 3).
+		WillReturnRows(sqlmock.NewRows(cols))
+	res, err = NewSelector[ShardOrder](db).Where(C("Amount").Gt(0)).
+		OrderBy(Desc("Id")).Limit(2).Offset(1).GetMulti(ctx)
+	require.NoError(t, err)
+	ids := make([]int64, 0, len(res))
+	for _, r := range res {
+		ids = append(ids, r.Id)
+	}
+	assert.Equal(t, []int64{7, 6}, ids)
+
+	// 跨分片不支持聚合
+	_, err = NewSelector[ShardOrder](db).Selectable(Count("Id")).GetMulti(ctx)
+	assert.Equal(t, errs.NewErrShardingUnsupported("跨分片的聚合函数"), err)
+
+	// 插入的时候按照每一行分组
+	db0.ExpectExec(regexp.QuoteMeta("INSERT INTO `order_1`(`id`,`user_id`,`amount`) VALUES (?,?,?),(?,?,?);")).
+		WithArgs(int64(1), int64(2), 10, int64(2), int64(6), 20).WillReturnResult(sqlmock.NewResult(0, 2))
+	db1.ExpectExec(regexp.QuoteMeta("INSERT INTO `order_0`(`id`,`user_id`,`amount`) VALUES (?,?,?);")).
+		WithArgs(int64(3), int64(1), 30).WillReturnResult(sqlmock.NewResult(0, 1))
+	affected, err := NewInserter[ShardOrder](db).Values(
+		&ShardOrder{Id: 1, UserId: 2, Amount: 10},
+		&ShardOrder{Id: 3, UserId: 1, Amount: 30},
+		&ShardOrder{Id: 2, UserId: 6, Amount: 20},
+	).Exec(ctx).RowsAffected()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), affected)
+
+	// 删除和更新
+	db0.ExpectExec(regexp.QuoteMeta("DELETE FROM `order_0` WHERE `user_id` IN (?,?);")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	db1.ExpectExec(regexp.QuoteMeta("DELETE FROM `order_0` WHERE `user_id` IN (?,?);")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	affected, err = NewDeleter[ShardOrder](db).Where(C("UserId").In(4, 5)).Exec(ctx).RowsAffected()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), affected)
+
+	db1.ExpectExec(regexp.QuoteMeta("UPDATE `order_1` SET `amount`=? WHERE `id` = ?;")).
+		WithArgs(10, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	err = NewUpdater[ShardOrder](db).Update(&ShardOrder{Id: 1, UserId: 3, Amount: 10}).
+		Set(C("Amount")).Where(C("Id").Eq(1)).Exec(ctx).Err()
+	require.NoError(t, err)
+
+	for _, mock := range mockDBs {
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestSharding_InTx(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db, err := OpenDB(mockDB, DBWithSharding(&ShardOrder{}, HashSharding{
+		Key: "UserId", TablePattern: "order_%d", TableCount: 2,
+	}))
+	require.NoError(t, err)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	err = db.DoTx(context.Background(), func(ctx context.Context, tx *Tx) error {
+		_, err := NewSelector[ShardOrder](tx).Where(C("UserId").Eq(1)).Get(ctx)
+		return err
+	}, nil)
+	assert.ErrorIs(t, err, ErrShardingInTx)
+}
+
+type ShardOrder struct {
+	Id     int64
+	UserId int64
+	Amount int
+}
@@ -0,0 +1,61 @@
+package orm
+
+import (
+	"database/sql"
+	"reflect"
+	"time"
+	"web/orm/model"
+)
+
+// softDeleteExpr 软删除模型“未删除”的条件
+// 时间类型的字段用 IS NULL 判断，bool 和整数这样的标记位用零值判断
+type softDeleteExpr struct {
+	// qualifier 表名或者别名，为空的时候不加限定
+	qualifier string
+	fd        *model.Field
+}
+
+func (softDeleteExpr) expr() {}
+
+func notDeleted(qualifier string, m *model.Model) Predicate {
+	return Predicate{
+		left: softDeleteExpr{qualifier: qualifier, fd: m.SoftDelete},
+	}
+}
+
+// buildSoftDelete 构造 `deleted_at` IS NULL 或者 `deleted` = ?
+func (b *builder) buildSoftDelete(e softDeleteExpr) {
+	if e.qualifier != "" {
+		b.quote(e.qualifier)
+		b.sb.WriteByte('.')
+	}
+	b.quote(e.fd.ColName)
+	if isTimeType(e.fd.Type) {
+		b.sb.WriteString(" IS NULL")
+		return
+	}
+	b.sb.WriteString(" = ?")
+	b.addArgs(reflect.Zero(e.fd.Type).Interface())
+}
+
+// softDeleteValue 软删除的时候写入的值，整数标记位写入 1
+func softDeleteValue(fd *model.Field, now time.Time) any {
+	if isTimeType(fd.Type) {
+		return now
+	}
+	switch fd.Type.Kind() {
+	case reflect.Bool:
+		return true
+	default:
+		return 1
+	}
+}
+
+func isTimeType(typ reflect.Type) bool {
+	switch typ {
+	case reflect.TypeOf(&time.Time{}), reflect.TypeOf(sql.NullTime{}):
+		return true
+	default:
+		return false
+	}
+}
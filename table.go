@@ -61,6 +61,24 @@ func (t Table) RightJoin(right TableReference) *JoinBuilder {
 	}
 }
 
+// JoinRelation 按照模型中声明的关联关系进行连接，ON 条件由元数据推导出来
+// 大概用法：TableOf(&User{}).JoinRelation("Orders")
+func (t Table) JoinRelation(field string) Join {
+	return Join{
+		left:     t,
+		typ:      " JOIN ",
+		relation: field,
+	}
+}
+
+func (t Table) LeftJoinRelation(field string) Join {
+	return Join{
+		left:     t,
+		typ:      " LEFT JOIN ",
+		relation: field,
+	}
+}
+
 // Join 连接
 // Join的几种写法：
 /*
@@ -76,6 +94,8 @@ type Join struct {
 	typ   string
 	on    []Predicate
 	using []string
+	// relation 关联字段的名字，不为空的时候 right 和 on 都由元数据推导
+	relation string
 }
 
 func (j Join) table() {
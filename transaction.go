@@ -4,6 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"web/orm/internal/errs"
 )
 
 var (
@@ -23,6 +27,14 @@ type Session interface {
 type Tx struct {
 	tx *sql.Tx
 	db *DB
+	// ctx 开启事务时候的 context，给 AfterCommit 的回调使用
+	ctx context.Context
+
+	mu         sync.Mutex
+	onCommit   []func()
+	onRollback []func()
+	// savepoints 嵌套事务用过的保存点个数，用来生成保存点的名字
+	savepoints int
 }
 
 func (t *Tx) getCore() core {
@@ -37,19 +49,166 @@ func (t *Tx) execContext(ctx context.Context, query string, args ...any) (sql.Re
 	return t.tx.ExecContext(ctx, query, args...)
 }
 
+// OnCommit 注册事务提交成功之后执行的回调
+// 在保存点里面注册的回调，回滚到保存点的时候会被丢弃
+func (t *Tx) OnCommit(fn func()) {
+	t.mu.Lock()
+	t.onCommit = append(t.onCommit, fn)
+	t.mu.Unlock()
+}
+
+// AfterCommit 注册事务提交成功之后执行的回调，一般用来发送消息
+// fn 拿到的是开启事务时候的 context，但是不会因为它被取消而取消，
+// 因为提交之后原本的请求可能已经结束了
+func (t *Tx) AfterCommit(fn func(ctx context.Context)) {
+	ctx := t.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = context.WithoutCancel(ctx)
+	t.OnCommit(func() {
+		fn(ctx)
+	})
+}
+
+// OnRollback 注册事务回滚之后执行的回调，提交失败也算回滚
+// 在保存点里面注册的回调，回滚到保存点的时候就会执行
+func (t *Tx) OnRollback(fn func()) {
+	t.mu.Lock()
+	t.onRollback = append(t.onRollback, fn)
+	t.mu.Unlock()
+}
+
+// Commit 提交事务，之后按照注册的顺序执行回调
 func (t *Tx) Commit() error {
-	return t.tx.Commit()
+	err := t.tx.Commit()
+	// 事务已经结束了，回调在结束的时候已经执行过了
+	if errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+	if err != nil {
+		t.runHooks(false)
+		return err
+	}
+	t.runHooks(true)
+	return nil
 }
 
 func (t *Tx) Rollback() error {
-	return t.tx.Rollback()
+	err := t.tx.Rollback()
+	if !errors.Is(err, sql.ErrTxDone) {
+		t.runHooks(false)
+	}
+	return err
 }
 
 func (t *Tx) RollbackIfNotCommit() error {
-	err := t.tx.Rollback()
+	err := t.Rollback()
 	// ErrTxDone 对已提交或回滚的事务执行的任何操作都会返回 ErrTxDone
 	if errors.Is(err, sql.ErrTxDone) {
 		return nil
 	}
 	return err
 }
+
+// runHooks 事务结束之后执行回调，回调只会执行一次
+func (t *Tx) runHooks(committed bool) {
+	t.mu.Lock()
+	hooks := t.onRollback
+	if committed {
+		hooks = t.onCommit
+	}
+	t.onCommit, t.onRollback = nil, nil
+	t.mu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// Savepoint 事务里面的保存点
+type Savepoint struct {
+	tx   *Tx
+	name string
+	// 创建保存点的时候已经注册的回调个数
+	commitMark   int
+	rollbackMark int
+}
+
+// savepointName 保存点的名字会直接拼到 SQL 里面，所以只允许字母、数字和下划线
+var savepointName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Savepoint 创建一个保存点，name 需要是合法的标识符
+func (t *Tx) Savepoint(ctx context.Context, name string) (*Savepoint, error) {
+	if !savepointName.MatchString(name) {
+		return nil, errs.NewErrInvalidSavepoint(name)
+	}
+	_, err := t.tx.ExecContext(ctx, t.getCore().dialect.savepoint(name))
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &Savepoint{
+		tx:           t,
+		name:         name,
+		commitMark:   len(t.onCommit),
+		rollbackMark: len(t.onRollback),
+	}, nil
+}
+
+// Release 释放保存点，保存点之后的修改会跟着外层事务一起提交或者回滚
+func (s *Savepoint) Release(ctx context.Context) error {
+	_, err := s.tx.tx.ExecContext(ctx, s.tx.getCore().dialect.releaseSavepoint(s.name))
+	return err
+}
+
+// RollbackTo 回滚到保存点，只撤销保存点之后的修改，外层事务还可以继续使用
+// 保存点之后注册的提交回调会被丢弃，回滚回调会马上执行
+func (s *Savepoint) RollbackTo(ctx context.Context) error {
+	_, err := s.tx.tx.ExecContext(ctx, s.tx.getCore().dialect.rollbackToSavepoint(s.name))
+	if err != nil {
+		return err
+	}
+	t := s.tx
+	t.mu.Lock()
+	var hooks []func()
+	if s.commitMark < len(t.onCommit) {
+		t.onCommit = t.onCommit[:s.commitMark]
+	}
+	if s.rollbackMark < len(t.onRollback) {
+		hooks = t.onRollback[s.rollbackMark:]
+		t.onRollback = t.onRollback[:s.rollbackMark:s.rollbackMark]
+	}
+	t.mu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+	return nil
+}
+
+// DoTx 嵌套事务闭包
+// 用保存点实现，fn 返回 error 或者 panic 的时候只回滚 fn 里面的修改，
+// 要不要回滚整个事务由外层决定
+func (t *Tx) DoTx(ctx context.Context, fn func(ctx context.Context, tx *Tx) error) (err error) {
+	t.mu.Lock()
+	t.savepoints++
+	name := fmt.Sprintf("sp_%d", t.savepoints)
+	t.mu.Unlock()
+	sp, err := t.Savepoint(ctx, name)
+	if err != nil {
+		return
+	}
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			e := sp.RollbackTo(ctx)
+			err = errs.NewErrFailedToRollbackTx(err, e, panicked)
+		} else {
+			err = sp.Release(ctx)
+		}
+	}()
+
+	err = fn(ctx, t)
+	panicked = false
+	return
+}
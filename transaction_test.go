@@ -0,0 +1,285 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"sync"
+	"testing"
+	"web/orm/internal/errs"
+)
+
+func TestTx_DoTx(t *testing.T) {
+	bizErr := errors.New("biz error")
+	testCases := []struct {
+		name    string
+		mock    func(mock sqlmock.Sqlmock)
+		fn      func(ctx context.Context, tx *Tx) error
+		wantErr error
+	}{
+		{
+			name: "release",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("SAVEPOINT sp_1;")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("DELETE FROM .*").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("RELEASE SAVEPOINT sp_1;")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			fn: func(ctx context.Context, tx *Tx) error {
+				return NewDeleter[TestModel](tx).Where(C("Id").Eq(1)).Exec(ctx).Err()
+			},
+		},
+		{
+			name: "rollback to",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("SAVEPOINT sp_1;")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("ROLLBACK TO SAVEPOINT sp_1;")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			fn: func(ctx context.Context, tx *Tx) error {
+				return bizErr
+			},
+			wantErr: bizErr,
+		},
+		{
+			// 内层失败只回滚内层，外层的保存点照常释放
+			name: "nested",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("SAVEPOINT sp_1;")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("SAVEPOINT sp_2;")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("ROLLBACK TO SAVEPOINT sp_2;")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("RELEASE SAVEPOINT sp_1;")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			fn: func(ctx context.Context, tx *Tx) error {
+				err := tx.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+					return bizErr
+				})
+				if !errors.Is(err, bizErr) {
+					return err
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer mockDB.Close()
+			db, err := OpenDB(mockDB)
+			require.NoError(t, err)
+
+			mock.ExpectBegin()
+			tc.mock(mock)
+			mock.ExpectCommit()
+
+			ctx := context.Background()
+			tx, err := db.BeginTx(ctx, nil)
+			require.NoError(t, err)
+			err = tx.DoTx(ctx, tc.fn)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			require.NoError(t, tx.Commit())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestTx_DoTxConcurrent 并发的嵌套事务也不能拿到同一个保存点的名字
+func TestTx_DoTxConcurrent(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	const n = 10
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectBegin()
+	for i := 1; i <= n; i++ {
+		mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("SAVEPOINT sp_%d;", i))).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("RELEASE SAVEPOINT sp_%d;", i))).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, tx.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+				return nil
+			}))
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTx_Savepoint(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SAVEPOINT _sp1;")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	_, err = tx.Savepoint(ctx, "_sp1")
+	require.NoError(t, err)
+
+	// 名字会拼到 SQL 里面，不是标识符的直接拒绝，不会发给数据库
+	for _, name := range []string{"", "1sp", "sp; DROP TABLE user", "`sp`"} {
+		_, err = tx.Savepoint(ctx, name)
+		assert.Equal(t, errs.NewErrInvalidSavepoint(name), err)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTx_Hooks(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(mock sqlmock.Sqlmock)
+		fn   func(ctx context.Context, tx *Tx, calls *[]string) error
+		// commit 为 true 的时候提交，否则回滚
+		commit    bool
+		wantCalls []string
+	}{
+		{
+			name: "commit",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectCommit()
+			},
+			commit:    true,
+			wantCalls: []string{"commit 1", "commit 2"},
+		},
+		{
+			name: "rollback",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectRollback()
+			},
+			wantCalls: []string{"rollback 1", "rollback 2"},
+		},
+		{
+			// 提交失败，真正的结果是回滚
+			name: "commit failed",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectCommit().WillReturnError(errors.New("mock error"))
+			},
+			commit:    true,
+			wantCalls: []string{"rollback 1", "rollback 2"},
+		},
+		{
+			name: "rollback to savepoint",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("SAVEPOINT sp_1;")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("ROLLBACK TO SAVEPOINT sp_1;")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			fn: func(ctx context.Context, tx *Tx, calls *[]string) error {
+				_ = tx.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+					tx.OnCommit(func() {
+						*calls = append(*calls, "nested commit")
+					})
+					tx.OnRollback(func() {
+						*calls = append(*calls, "nested rollback")
+					})
+					return errors.New("mock error")
+				})
+				return nil
+			},
+			commit:    true,
+			wantCalls: []string{"nested rollback", "commit 1", "commit 2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer mockDB.Close()
+			db, err := OpenDB(mockDB)
+			require.NoError(t, err)
+			mock.ExpectBegin()
+			tc.mock(mock)
+
+			ctx := context.Background()
+			tx, err := db.BeginTx(ctx, nil)
+			require.NoError(t, err)
+			var calls []string
+			for _, i := range []string{"1", "2"} {
+				tx.OnCommit(func() {
+					calls = append(calls, "commit "+i)
+				})
+				tx.OnRollback(func() {
+					calls = append(calls, "rollback "+i)
+				})
+			}
+			if tc.fn != nil {
+				require.NoError(t, tc.fn(ctx, tx, &calls))
+			}
+			if tc.commit {
+				_ = tx.Commit()
+			} else {
+				_ = tx.Rollback()
+			}
+			// 事务结束之后回调不会再执行
+			_ = tx.RollbackIfNotCommit()
+			assert.Equal(t, tc.wantCalls, calls)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestTx_AfterCommit(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	type key struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "val"))
+	var got context.Context
+	err = db.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+		tx.AfterCommit(func(ctx context.Context) {
+			got = ctx
+		})
+		// 提交之前不会执行
+		assert.Nil(t, got)
+		return nil
+	}, nil)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	// 请求结束了，回调拿到的 context 也不能被取消
+	cancel()
+	assert.Equal(t, "val", got.Value(key{}))
+	assert.NoError(t, got.Err())
+}
@@ -29,4 +29,7 @@ type Query struct {
 	// 占位符，Args中的参数通过占位符传入SQL中
 	SQL  string
 	Args []any
+
+	// dialect 只用于 Interpolate，经过 QueryContext.Query 拿到的 Query 才有
+	dialect Dialect
 }
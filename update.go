@@ -0,0 +1,241 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"time"
+	"web/orm/internal/errs"
+	"web/orm/internal/valuer"
+	"web/orm/model"
+)
+
+// Updater 用于构造 UPDATE 语句
+// 大概用法：NewUpdater[User](db).Update(&user).Set(C("Age"), Assign("Name", "Tom")).Where(C("Id").Eq(1))
+type Updater[T any] struct {
+	builder
+	val     *T
+	assigns []Assignable
+	where   []Predicate
+	sess    Session
+	// at 第一次 Build 的时候确定的更新时间，
+	// 中间件、dry-run 多次构造语句的时候不会重复修改实体
+	at time.Time
+}
+
+func NewUpdater[T any](sess Session) *Updater[T] {
+	c := sess.getCore()
+	return &Updater[T]{
+		builder: builder{
+			core:   c,
+			quoter: c.dialect.quoter(),
+		},
+		sess: sess,
+	}
+}
+
+// Update 指定用来更新的实体
+// 没有调用 Set 的时候会更新实体的所有列，
+// 模型有版本号字段的时候会用实体上的版本号做乐观锁
+func (u *Updater[T]) Update(val *T) *Updater[T] {
+	u.val = val
+	u.at = time.Time{}
+	return u
+}
+
+// Set 指定要更新的列
+// C("Age") 表示用实体上 Age 的值更新，Assign("Age", 18) 表示直接赋值
+func (u *Updater[T]) Set(assigns ...Assignable) *Updater[T] {
+	u.assigns = assigns
+	return u
+}
+
+func (u *Updater[T]) Where(ps ...Predicate) *Updater[T] {
+	u.where = ps
+	return u
+}
+
+func (u *Updater[T]) Build() (*Query, error) {
+	u.reset()
+	var err error
+	if u.model == nil {
+		u.model, err = u.r.Get(new(T))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if u.at.IsZero() {
+		u.at = u.now()
+		if fd := u.model.AutoUpdateTime; fd != nil && u.val != nil {
+			setAutoTime(u.val, fd, u.at, false)
+		}
+	}
+	now := u.at
+	var val valuer.Value
+	if u.val != nil {
+		val = u.creator(u.model, u.val)
+	}
+
+	assigns := u.assigns
+	if len(assigns) == 0 {
+		if u.val == nil {
+			return nil, errs.ErrUpdateNoColumns
+		}
+		assigns = make([]Assignable, 0, len(u.model.Fields))
+		for _, fd := range u.model.Fields {
+			assigns = append(assigns, C(fd.GoName))
+		}
+	}
+	// 只更新部分列的时候，也要维护更新时间
+	if fd := u.model.AutoUpdateTime; fd != nil && !(&Upsert{assigns: assigns}).assigned(fd.GoName) {
+		assigns = append(assigns[:len(assigns):len(assigns)], Assign(fd.GoName, autoTimeValue(fd, now)))
+	}
+
+	u.sb.WriteString("UPDATE ")
+	u.quote(u.model.TableName)
+	u.sb.WriteString(" SET ")
+	cnt := 0
+	for _, assign := range assigns {
+		var fd *model.Field
+		var arg any
+		switch a := assign.(type) {
+		case Assignment:
+			fd, err = u.field(a.col)
+			arg = a.val
+		case Column:
+			fd, err = u.field(a.name)
+			if err == nil {
+				if val == nil {
+					return nil, errs.ErrUpdateNoEntity
+				}
+				arg, err = val.Field(a.name)
+			}
+		default:
+			return nil, errs.NewErrUnsupportedAssignable(assign)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// 版本号只能由框架自己维护
+		if fd == u.model.Version {
+			continue
+		}
+		if cnt > 0 {
+			u.sb.WriteByte(',')
+		}
+		cnt++
+		u.quote(fd.ColName)
+		u.sb.WriteString("=?")
+		u.addArgs(arg)
+	}
+
+	// 版本号的条件是框架加的，用户没有指定条件的时候一样是更新整张表
+	if len(u.where) == 0 {
+		return nil, errs.ErrUpdateALL
+	}
+	where := u.where
+	if ver := u.model.Version; ver != nil {
+		// `version`=`version`+1
+		if cnt > 0 {
+			u.sb.WriteByte(',')
+		}
+		u.quote(ver.ColName)
+		u.sb.WriteByte('=')
+		u.quote(ver.ColName)
+		u.sb.WriteString("+1")
+		// 有实体的时候，只有版本号没有变过才能更新成功
+		if val != nil {
+			cur, err := val.Field(ver.GoName)
+			if err != nil {
+				return nil, err
+			}
+			where = append(where[:len(where):len(where)], C(ver.GoName).Eq(cur))
+		}
+	}
+
+	u.sb.WriteString(" WHERE ")
+	p := where[0]
+	for i := 1; i < len(where); i++ {
+		p = p.And(where[i])
+	}
+	if err = u.buildExpression(p); err != nil {
+		return nil, err
+	}
+	u.sb.WriteByte(';')
+	return &Query{
+		SQL:  u.sb.String(),
+		Args: u.args,
+	}, nil
+}
+
+func (u *Updater[T]) field(name string) (*model.Field, error) {
+	fd, ok := u.model.FieldMap[name]
+	if !ok {
+		return nil, errs.NewErrUnknownField(name)
+	}
+	return fd, nil
+}
+
+// Exec 执行
+// 使用乐观锁的时候，没有影响任何行会返回 ErrOptimisticLock，
+// 更新成功之后实体上的版本号会加一，和数据库保持一致。dry-run 的时候不检查乐观锁
+func (u *Updater[T]) Exec(ctx context.Context) Result {
+	var err error
+	u.model, err = u.r.Get(new(T))
+	if err != nil {
+		return Result{
+			err: err,
+		}
+	}
+	ctx = withSession(ctx, u.sess)
+	if u.val != nil {
+		if h, ok := any(u.val).(BeforeUpdateHook); ok {
+			if err = h.BeforeUpdate(ctx); err != nil {
+				return Result{
+					err: err,
+				}
+			}
+		}
+	}
+	var res *QueryResult
+	if algo, ok := shardingAlgo[T](u.core); ok {
+		res = u.shardingExec(ctx, algo)
+	} else {
+		res = exec(ctx, u.sess, u.core, &QueryContext{
+			Type:    "UPDATE",
+			Builder: u,
+			Model:   u.model,
+		})
+	}
+
+	var sqlRes sql.Result
+	if res.Result != nil {
+		sqlRes = res.Result.(sql.Result)
+	}
+	// 中间件可能没有返回结果，这时候没办法判断乐观锁。
+	// dry-run 的时候语句没有执行，也不检查乐观锁，版本号保持不变
+	if res.Err != nil || sqlRes == nil || u.model.Version == nil || u.val == nil ||
+		u.recorder(ctx) != nil {
+		return Result{
+			err: res.Err,
+			res: sqlRes,
+		}
+	}
+
+	affected, err := sqlRes.RowsAffected()
+	if err == nil && affected == 0 {
+		err = errs.ErrOptimisticLock
+	}
+	if err == nil {
+		fd := reflect.ValueOf(u.val).Elem().FieldByName(u.model.Version.GoName)
+		if fd.CanInt() {
+			fd.SetInt(fd.Int() + 1)
+		} else {
+			fd.SetUint(fd.Uint() + 1)
+		}
+	}
+	return Result{
+		err: err,
+		res: sqlRes,
+	}
+}
@@ -0,0 +1,173 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"web/orm/internal/errs"
+	"web/orm/internal/valuer"
+	"web/orm/model"
+)
+
+func TestUpdater_Build(t *testing.T) {
+	db := &DB{
+		core: core{
+			r:       model.NewRegistry(),
+			dialect: DialectMySOL,
+			creator: valuer.NewUnsafeValue,
+		},
+	}
+	testCases := []struct {
+		name      string
+		q         QueryBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name: "all columns",
+			q:    NewUpdater[TestModel](db).Update(&TestModel{Id: 1, FirstName: "Tom", Age: 18}).Where(C("Id").Eq(1)),
+			wantQuery: &Query{
+				SQL:  "UPDATE `test_model` SET `id`=?,`first_name`=?,`age`=?,`last_name`=? WHERE `id` = ?;",
+				Args: []any{int64(1), "Tom", int8(18), (*sql.NullString)(nil), 1},
+			},
+		},
+		{
+			name: "set",
+			q: NewUpdater[TestModel](db).Update(&TestModel{Age: 18}).
+				Set(C("Age"), Assign("FirstName", "Jerry")).Where(C("Id").Eq(1)),
+			wantQuery: &Query{
+				SQL:  "UPDATE `test_model` SET `age`=?,`first_name`=? WHERE `id` = ?;",
+				Args: []any{int8(18), "Jerry", 1},
+			},
+		},
+		{
+			name:    "no columns",
+			q:       NewUpdater[TestModel](db),
+			wantErr: errs.ErrUpdateNoColumns,
+		},
+		{
+			name:    "column without entity",
+			q:       NewUpdater[TestModel](db).Set(C("Age")),
+			wantErr: errs.ErrUpdateNoEntity,
+		},
+		{
+			name:    "unknown field",
+			q:       NewUpdater[TestModel](db).Set(Assign("Invalid", 1)),
+			wantErr: errs.NewErrUnknownField("Invalid"),
+		},
+		{
+			name: "version",
+			q: NewUpdater[VersionModel](db).Update(&VersionModel{Id: 1, Name: "Tom", Version: 3}).
+				Set(C("Name"), C("Version")).Where(C("Id").Eq(1)),
+			wantQuery: &Query{
+				SQL:  "UPDATE `version_model` SET `name`=?,`version`=`version`+1 WHERE (`id` = ?) AND (`version` = ?);",
+				Args: []any{"Tom", 1, int64(3)},
+			},
+		},
+		{
+			name: "version without entity",
+			q:    NewUpdater[VersionModel](db).Set(Assign("Name", "Tom")).Where(C("Id").Eq(1)),
+			wantQuery: &Query{
+				SQL:  "UPDATE `version_model` SET `name`=?,`version`=`version`+1 WHERE `id` = ?;",
+				Args: []any{"Tom", 1},
+			},
+		},
+		{
+			name:    "update all",
+			q:       NewUpdater[TestModel](db).Set(Assign("Age", 18)),
+			wantErr: errs.ErrUpdateALL,
+		},
+		{
+			// 只有版本号的条件也是更新整张表
+			name:    "version update all",
+			q:       NewUpdater[VersionModel](db).Update(&VersionModel{Id: 1, Name: "Tom", Version: 3}),
+			wantErr: errs.ErrUpdateALL,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := tc.q.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, q)
+		})
+	}
+}
+
+func TestUpdater_OptimisticLock(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db := &DB{
+		db: mockDB,
+		core: core{
+			r:       model.NewRegistry(),
+			dialect: DialectMySOL,
+			creator: valuer.NewUnsafeValue,
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		affected    int64
+		wantErr     error
+		wantVersion int64
+	}{
+		{
+			name:        "success",
+			affected:    1,
+			wantVersion: 4,
+		},
+		{
+			name:        "conflict",
+			affected:    0,
+			wantErr:     ErrOptimisticLock,
+			wantVersion: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock.ExpectExec("UPDATE `version_model` .*").
+				WillReturnResult(sqlmock.NewResult(0, tc.affected))
+			val := &VersionModel{Id: 1, Name: "Tom", Version: 3}
+			res := NewUpdater[VersionModel](db).Update(val).Set(C("Name")).
+				Where(C("Id").Eq(1)).Exec(context.Background())
+			assert.Equal(t, tc.wantErr, res.Err())
+			assert.Equal(t, tc.wantVersion, val.Version)
+		})
+	}
+}
+
+func TestUpdater_ExecNilResult(t *testing.T) {
+	// 中间件直接返回了空的结果，不能 panic
+	db := &DB{
+		core: core{
+			r:       model.NewRegistry(),
+			dialect: DialectMySOL,
+			creator: valuer.NewUnsafeValue,
+			mdls: []Middleware{func(next Handler) Handler {
+				return func(ctx context.Context, qc *QueryContext) *QueryResult {
+					return &QueryResult{}
+				}
+			}},
+		},
+	}
+	val := &VersionModel{Id: 1, Name: "Tom", Version: 3}
+	res := NewUpdater[VersionModel](db).Update(val).Set(C("Name")).
+		Where(C("Id").Eq(1)).Exec(context.Background())
+	assert.NoError(t, res.Err())
+	assert.Equal(t, int64(3), val.Version)
+}
+
+type VersionModel struct {
+	Id      int64
+	Name    string
+	Version int64 `orm:"version"`
+}